@@ -0,0 +1,172 @@
+package cf
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+// AuditFinding is a security issue of a kubeconfig file or a file of kubectl-cf
+type AuditFinding struct {
+	Path  string
+	Issue string
+
+	// FixMode is the mode "cf harden" sets to fix the issue, 0 if the issue can not be fixed automatically
+	FixMode os.FileMode
+}
+
+type AuditFindings []AuditFinding
+
+// Issues returns the issues of the findings
+func (f AuditFindings) Issues() []string {
+	var issues []string
+	for _, finding := range f {
+		issues = append(issues, finding.Issue)
+	}
+	return issues
+}
+
+// trustedDirs returns the directories which symlinked kubeconfig files may point into,
+// symlinks are resolved for the kubeconfig dir, the kubectl-cf config dir and scannedDirs,
+// the roots of other sources are trusted as they are, since resolving them may hang on network shares
+func trustedDirs(currentKubeconfigPath string, scannedDirs ...string) []string {
+	dirs := append([]string{kubeconfigDir, kubectlCfConfigDir}, scannedDirs...)
+	var trusted []string
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			trusted = append(trusted, abs)
+		}
+	}
+	for _, root := range sourceRoots(currentKubeconfigPath) {
+		if abs, err := filepath.Abs(root); err == nil {
+			trusted = append(trusted, abs)
+		}
+	}
+	return trusted
+}
+
+// isInDirs returns true if path is in one of dirs
+func isInDirs(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditFile checks whether the file (or directory) at path is accessible by other users,
+// owned by another user, or is a symlink pointing outside trustedDirs
+func auditFile(path string, trustedDirs []string) AuditFindings {
+	var findings AuditFindings
+
+	lstat, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	if sys.IsSymlink(lstat) {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return AuditFindings{{Path: path, Issue: t("auditDanglingSymlink")}}
+		}
+		if !isInDirs(target, trustedDirs) {
+			findings = append(findings, AuditFinding{Path: path, Issue: t("auditSymlinkOutsideTrustedDirs", target)})
+		}
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return findings
+	}
+	if uid, ok := sys.FileOwner(stat); ok && uid != os.Getuid() {
+		findings = append(findings, AuditFinding{Path: path, Issue: t("auditForeignOwner", uid)})
+	}
+	if runtime.GOOS == "windows" { // file modes are not meaningful on Windows
+		return findings
+	}
+	if stat.IsDir() {
+		if stat.Mode().Perm()&0077 != 0 {
+			findings = append(findings, AuditFinding{Path: path, Issue: t("auditAccessibleByOthers", stat.Mode().Perm()), FixMode: ConfigDirMode})
+		}
+	} else if stat.Mode().Perm()&0077 != 0 {
+		findings = append(findings, AuditFinding{Path: path, Issue: t("auditAccessibleByOthers", stat.Mode().Perm()), FixMode: ConfigFileMode})
+	}
+	return findings
+}
+
+// Audit checks all candidates, the kubectl-cf config dir and everything in it
+func Audit() (AuditFindings, error) {
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+	candidates, sourceErrors := ListKubeconfigCandidates(currentKubeconfigPath)
+	for _, sourceError := range sourceErrors {
+		logger.Warn(sourceError.Error())
+	}
+	var scannedDirs []string
+	for _, source := range sourceDirs(currentKubeconfigPath) {
+		scannedDirs = append(scannedDirs, source.Path)
+	}
+	for _, candidate := range candidates {
+		if !isExecPath(candidate.FullPath) { // files listed by exec sources are trusted like scanned directories
+			scannedDirs = append(scannedDirs, filepath.Dir(candidate.FullPath))
+		}
+	}
+	trustedDirs := trustedDirs(currentKubeconfigPath, scannedDirs...)
+
+	var findings AuditFindings
+	for _, candidate := range candidates {
+		findings = append(findings, auditFile(candidate.FullPath, trustedDirs)...)
+	}
+	err = filepath.WalkDir(kubectlCfConfigDir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		findings = append(findings, auditFile(path, trustedDirs)...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "filepath.WalkDir error")
+	}
+	return findings, nil
+}
+
+// runHarden implements "cf harden", which fixes the modes of files found by Audit
+func runHarden(args []string) error {
+	flags := flag.NewFlagSet("cf harden", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only print the issues found")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	findings, err := Audit()
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		fmt.Println(text(t("auditNoIssues")))
+		return nil
+	}
+	for _, finding := range findings {
+		if finding.FixMode == 0 || *dryRun {
+			fmt.Printf("%s: %s\n", info(finding.Path), warning(finding.Issue))
+			continue
+		}
+		if err := os.Chmod(finding.Path, finding.FixMode); err != nil {
+			return errors.Wrap(err, "os.Chmod error")
+		}
+		fmt.Printf("%s: %s, %s\n", info(finding.Path), finding.Issue, text(t("auditFixedMode", finding.FixMode)))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAuditFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and symlinks are not audited the same way on Windows")
+	}
+	trusted, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted := t.TempDir()
+	outside := writeTestFile(t, untrusted, "outside.yaml", "")
+	inside := writeTestFile(t, trusted, "inside.yaml", "")
+
+	for _, c := range []struct {
+		name    string
+		setup   func(path string) error
+		mode    os.FileMode // set after setup regardless of the umask, 0 for symlinks
+		finding bool
+		fixMode os.FileMode
+	}{
+		{"private file", func(path string) error { return os.WriteFile(path, nil, 0600) }, 0600, false, 0},
+		{"readable file", func(path string) error { return os.WriteFile(path, nil, 0600) }, 0644, true, ConfigFileMode},
+		{"group writable file", func(path string) error { return os.WriteFile(path, nil, 0600) }, 0620, true, ConfigFileMode},
+		{"private dir", func(path string) error { return os.Mkdir(path, 0700) }, 0700, false, 0},
+		{"readable dir", func(path string) error { return os.Mkdir(path, 0700) }, 0755, true, ConfigDirMode},
+		{"symlink inside trusted dirs", func(path string) error { return os.Symlink(inside, path) }, 0, false, 0},
+		{"symlink outside trusted dirs", func(path string) error { return os.Symlink(outside, path) }, 0, true, 0},
+		{"dangling symlink", func(path string) error { return os.Symlink(filepath.Join(trusted, "missing"), path) }, 0, true, 0},
+	} {
+		path := filepath.Join(trusted, "audit")
+		if err := c.setup(path); err != nil {
+			t.Fatal(err)
+		}
+		if c.mode != 0 {
+			if err := os.Chmod(path, c.mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		findings := auditFile(path, []string{trusted})
+		if !c.finding && len(findings) != 0 {
+			t.Errorf("%s: unexpected findings %v", c.name, findings.Issues())
+		}
+		if c.finding && (len(findings) != 1 || findings[0].FixMode != c.fixMode) {
+			t.Errorf("%s: got findings %+v, want one fixed with mode %v", c.name, findings, c.fixMode)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuditFileForeignOwner(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Getuid() != 0 {
+		t.Skip("changing the owner of a file requires root")
+	}
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "foreign.yaml", "")
+	if err := os.Chown(path, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	findings := auditFile(path, []string{dir})
+	if len(findings) != 1 || findings[0].FixMode != 0 {
+		t.Errorf("got findings %+v, want one which can not be fixed automatically", findings)
+	}
+}
+
+func TestRunHarden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not audited on Windows")
+	}
+	path := writeTestFile(t, kubeconfigDir, "harden.yaml", "kind: Config\n")
+	t.Cleanup(func() { _ = os.Remove(path) })
+	resetKubeconfigSymlink(t, path) // kubeconfigDir is scanned as the dir of the current kubeconfig
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		args []string
+		want os.FileMode
+	}{
+		{[]string{"--dry-run"}, 0644},
+		{nil, ConfigFileMode},
+	} {
+		if err := runHarden(c.args); err != nil {
+			t.Fatal(err)
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Mode().Perm() != c.want {
+			t.Errorf("cf harden %v: got mode %v, want %v", c.args, stat.Mode().Perm(), c.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cf
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+const backupsArgs = "list | restore <backup> | prune [--keep N] [--older-than AGE] [--dry-run]"
+
+// Backup is a file moved aside by kubectl-cf
+type Backup struct {
+	sys.BackUp
+	ModTime time.Time
+	Size    int64
+}
+
+// Name returns the file name of the backup, which identifies the backup in commands
+func (b Backup) Name() string {
+	return filepath.Base(b.Path)
+}
+
+// ListBackups finds the backups created by kubectl-cf, newest first:
+// "<kubeconfig>-backup-N" created by sys.CreateSymlink,
+// and "default-kubeconfig-N.yaml" created when kubectl-cf takes control of a kubeconfig file
+func ListBackups() ([]Backup, error) {
+	var found []sys.BackUp
+	for _, pattern := range []struct{ basePath, suffix string }{
+		{kubeconfigPath + "-backup", ""},
+		{filepath.Join(kubeconfigDir, DefaultKubeconfigBaseName), ".yaml"},
+	} {
+		backUps, err := sys.FindBackUps(pattern.basePath, pattern.suffix)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, backUps...)
+	}
+
+	var backups []Backup
+	for _, b := range found {
+		stat, err := os.Stat(b.Path)
+		if err != nil {
+			logger.Debugf("Unable to stat backup %s: %s", b.Path, err)
+			continue
+		}
+		backups = append(backups, Backup{BackUp: b, ModTime: stat.ModTime(), Size: stat.Size()})
+	}
+	slices.SortFunc(backups, func(a, b Backup) int { return b.ModTime.Compare(a.ModTime) })
+	return backups, nil
+}
+
+// humanDuration formats d roughly, like "3d", "5h", "10m"
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// humanSize formats size in bytes, like "512B", "1.5KiB"
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// parseAge parses durations like "720h", with an extra unit "d" for days, like "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid age %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid age %s", s)
+	}
+	return d, nil
+}
+
+// findBackup finds the backup by name or path
+func findBackup(backups []Backup, arg string) (Backup, error) {
+	for _, b := range backups {
+		if b.Name() == arg || b.Path == arg {
+			return b, nil
+		}
+	}
+	return Backup{}, errors.New(t("noBackupFound", arg))
+}
+
+// runBackups implements "cf backups list|restore|prune"
+func runBackups(args []string) error {
+	if len(args) == 0 {
+		return errors.New(t("commandUsage", "backups", backupsArgs))
+	}
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listBackups(backups)
+	case "restore":
+		if len(args) != 2 {
+			return errors.New(t("commandUsage", "backups restore", "<backup>"))
+		}
+		return restoreBackup(backups, args[1])
+	case "prune":
+		return pruneBackups(backups, args[1:])
+	default:
+		return errors.New(t("commandUsage", "backups", backupsArgs))
+	}
+}
+
+func listBackups(backups []Backup) error {
+	if len(backups) == 0 {
+		fmt.Println(t("noBackups"))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tAGE\tSIZE\tPATH")
+	for _, b := range backups {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Name(), humanDuration(time.Since(b.ModTime)), humanSize(b.Size), b.Path)
+	}
+	return w.Flush()
+}
+
+// restoreBackup atomically points the kubeconfig symlink to the backup
+func restoreBackup(backups []Backup, arg string) error {
+	backup, err := findBackup(backups, arg)
+	if err != nil {
+		return err
+	}
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	replaced, _ := os.Readlink(kubeconfigPath)
+	o := beginOperation(t("restoreBackupDescription", backup.Path))
+	defer o.Commit()
+	if err := o.WriteFile(previousKubeconfigConfigPath, &currentKubeconfigPath, ConfigFileMode); err != nil {
+		return errors.New(t("updatePreviousKubeconfigError", err.Error()))
+	}
+	if err := o.ReplaceSymlink(symlinkTarget(backup.Path), kubeconfigPath); err != nil {
+		return errors.New(t("createSymlinkError", err.Error()))
+	}
+	wipeReplacedRuntimeFile(replaced, backup.Path)
+	fmt.Println(text(t("symlinkNowPointTo", info(kubeconfigPath), info(backup.Path))))
+	return nil
+}
+
+// pruneBackups moves backups to the trash dir beyond the newest --keep ones, or older than --older-than,
+// backups in use by the kubeconfig symlink or the previous file are never removed,
+// neither are files without a revision number, like default-kubeconfig.yaml, which is the original kubeconfig
+func pruneBackups(backups []Backup, args []string) error {
+	flags := flag.NewFlagSet("cf backups prune", flag.ContinueOnError)
+	keep := flags.Int("keep", -1, "keep the newest N backups")
+	olderThan := flags.String("older-than", "", "remove backups older than the age, like 720h or 30d")
+	dryRun := flags.Bool("dry-run", false, "only print the backups which would be removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *keep < 0 && *olderThan == "" {
+		return errors.New(t("commandUsage", "backups prune", "--keep N | --older-than AGE [--dry-run]"))
+	}
+	if *keep > sys.MaxBackUpRevisions {
+		return errors.New(t("tooManyBackupsToKeep", sys.MaxBackUpRevisions))
+	}
+	var maxAge time.Duration
+	if *olderThan != "" {
+		var err error
+		if maxAge, err = parseAge(*olderThan); err != nil {
+			return err
+		}
+	}
+
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	previous, err := readPreviousKubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	o := beginOperation(t("pruneBackupsDescription"))
+	defer o.Commit()
+	for i, b := range backups { // backups are sorted newest first
+		expired := *keep >= 0 && i >= *keep
+		expired = expired || (*olderThan != "" && time.Since(b.ModTime) > maxAge)
+		if !expired {
+			continue
+		}
+		if isSamePath(b.Path, currentKubeconfigPath) || isSamePath(b.Path, previous) {
+			fmt.Println(t("skipBackupInUse", b.Path))
+			continue
+		}
+		if b.Revision == 0 {
+			fmt.Println(t("skipOriginalBackup", b.Path))
+			continue
+		}
+		if *dryRun {
+			fmt.Println(t("wouldRemoveBackup", b.Path))
+			continue
+		}
+		trashPath, err := o.MoveToTrash(b.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(t("removedBackup", b.Path, trashPath))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneBackupsKeepsOriginalKubeconfig(t *testing.T) {
+	original := writeTestFile(t, kubeconfigDir, DefaultKubeconfigBaseName+".yaml", "original")
+	first := writeTestFile(t, kubeconfigDir, DefaultKubeconfigBaseName+"-1.yaml", "first")
+	second := writeTestFile(t, kubeconfigDir, filepath.Base(kubeconfigPath)+"-backup-1", "second")
+	t.Cleanup(func() {
+		for _, path := range []string{original, first, second} {
+			_ = os.Remove(path)
+		}
+	})
+	now := time.Now()
+	for i, path := range []string{original, first, second} {
+		if err := os.Chtimes(path, now, now.Add(-time.Duration(3-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 || backups[0].Path != second || backups[2].Path != original {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+
+	if err := pruneBackups(backups, []string{"--keep", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(original); err != nil {
+		t.Errorf("original kubeconfig is pruned: %s", err)
+	}
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("backup %s is not pruned", path)
+		}
+	}
+}
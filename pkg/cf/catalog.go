@@ -0,0 +1,374 @@
+package cf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A catalog source is an HTTPS URL returning catalogResponse as JSON, the kubeconfigs in the catalog are downloaded
+// into a cache dir in catalogsDirPath, and listed like kubeconfig files found in directories.
+// Kubeconfigs may run commands by exec auth plugins, so a catalog is never downloaded over plain HTTP,
+// and a kubeconfig is only downloaded over plain HTTP if the catalog has its checksum.
+// Requests are conditional with ETag and Last-Modified, and the last cached copy is used if the server can not be reached.
+
+// catalogResponse is the body of a catalog
+type catalogResponse struct {
+	Kubeconfigs []catalogKubeconfig `json:"kubeconfigs"`
+}
+
+// catalogKubeconfig is a kubeconfig in a catalog
+type catalogKubeconfig struct {
+	// Name is the name of the kubeconfig, which may contain "/", unique in the catalog
+	Name string `json:"name"`
+
+	// Description is shown in the list instead of the path, optional
+	Description string `json:"description,omitempty"`
+
+	// URL is the URL of the kubeconfig, relative to the URL of the catalog
+	URL string `json:"url"`
+
+	// SHA256 is the hex-encoded sha256 checksum of the kubeconfig, a downloaded file not matching it is rejected,
+	// optional if URL is https
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// validators are the response headers of a cached URL, sent back to only download it if it is changed
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// catalogCache is the cache dir of a catalog source, with the last catalog, the validators of each URL,
+// and the downloaded kubeconfigs named by their names in the catalog
+type catalogCache struct {
+	dir        string
+	validators map[string]validators // by URL
+}
+
+const (
+	catalogFileName    = "catalog.json"
+	validatorsFileName = "validators.json"
+	kubeconfigsDirName = "kubeconfigs"
+)
+
+// catalogTransport is the transport of requests to catalogs, nil for http.DefaultTransport
+var catalogTransport http.RoundTripper
+
+// isCatalogURL returns true if the path of a source is the URL of a catalog, http ones are listed as errors
+func isCatalogURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// isCatalogFile returns true if path is a kubeconfig downloaded from a catalog, which is replaced on the next download
+func isCatalogFile(path string) bool {
+	return isInDirs(path, []string{catalogsDirPath})
+}
+
+// catalogCacheDir returns the cache dir of the catalog at catalogURL
+func catalogCacheDir(catalogURL string) string {
+	sum := sha256.Sum256([]byte(catalogURL))
+	return filepath.Join(catalogsDirPath, hex.EncodeToString(sum[:8]))
+}
+
+// openCatalogCache opens the cache dir of the catalog at catalogURL, it is created if not exist
+func openCatalogCache(catalogURL string) (*catalogCache, error) {
+	cache := &catalogCache{dir: catalogCacheDir(catalogURL), validators: map[string]validators{}}
+	if err := os.MkdirAll(filepath.Join(cache.dir, kubeconfigsDirName), ConfigDirMode); err != nil {
+		return nil, errors.Wrap(err, "create catalog cache dir error")
+	}
+	f, err := os.ReadFile(filepath.Join(cache.dir, validatorsFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if err == nil {
+		if err := json.Unmarshal(f, &cache.validators); err != nil {
+			logger.Debugf("Corrupted validators of catalog %s, downloading everything again: %s", catalogURL, err)
+			cache.validators = map[string]validators{}
+		}
+	}
+	return cache, nil
+}
+
+// save writes the validators of the cache
+func (c *catalogCache) save() error {
+	f, err := json.Marshal(c.validators)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+	return writeFileAtomic(filepath.Join(c.dir, validatorsFileName), f)
+}
+
+// kubeconfigPath returns the path of the downloaded kubeconfig name in the cache
+func (c *catalogCache) kubeconfigPath(name string) string {
+	return filepath.Join(c.dir, kubeconfigsDirName, filepath.FromSlash(name))
+}
+
+// writeFileAtomic writes content to path with ConfigFileMode, readers never see a partially written file
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), ConfigDirMode); err != nil {
+		return errors.Wrap(err, "os.MkdirAll error")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*") // created with mode 0600
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp error")
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrapf(err, "write %s error", path)
+	}
+	return nil
+}
+
+// download gets u, with the cached validators of u if cached is true, so the server responds 304 if it is not changed,
+// returns the body, or nil if it is not changed
+func (c *catalogCache) download(u string, cached bool) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest error")
+	}
+	req.Header.Set("User-Agent", "kubectl-cf")
+	if v, ok := c.validators[u]; ok && cached {
+		if v.ETag != "" {
+			req.Header.Set("If-None-Match", v.ETag)
+		}
+		if v.LastModified != "" {
+			req.Header.Set("If-Modified-Since", v.LastModified)
+		}
+	}
+	client := &http.Client{Timeout: CatalogRequestTimeout, Transport: catalogTransport, CheckRedirect: checkCatalogRedirect}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "http request error")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		logger.Debugf("%s is not modified", u)
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New(t("catalogStatusError", u, resp.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, SniffSizeLimit+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body error")
+	}
+	if len(body) > SniffSizeLimit {
+		return nil, errors.New(t("catalogTooLarge", u, SniffSizeLimit))
+	}
+	c.validators[u] = validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	return body, nil
+}
+
+// checkCatalogRedirect follows redirects like the default policy, but never from https to plain http
+func checkCatalogRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return errors.New(t("catalogInsecureRedirect", via[0].URL, req.URL))
+	}
+	return nil
+}
+
+// fetchCatalog returns the catalog at catalogURL, downloaded if it is changed, or the cached one if it is not,
+// if the catalog can not be downloaded, the cached one is returned with the error
+func (c *catalogCache) fetchCatalog(catalogURL string) (*catalogResponse, error) {
+	catalogPath := filepath.Join(c.dir, catalogFileName)
+	cachedBody, readErr := os.ReadFile(catalogPath)
+	body, err := c.download(catalogURL, readErr == nil)
+	if err == nil && body != nil {
+		var catalog catalogResponse
+		if err = json.Unmarshal(body, &catalog); err == nil {
+			if err := writeFileAtomic(catalogPath, body); err != nil {
+				logger.Debugf("Unable to cache catalog %s: %s", catalogURL, err)
+				delete(c.validators, catalogURL)
+			}
+			return &catalog, nil
+		}
+		delete(c.validators, catalogURL) // never respond 304 for an invalid catalog
+		err = errors.Wrapf(err, "invalid catalog %s", catalogURL)
+	}
+	if readErr != nil { // never downloaded, the request is not conditional
+		return nil, err
+	}
+
+	var catalog catalogResponse
+	if jsonErr := json.Unmarshal(cachedBody, &catalog); jsonErr != nil {
+		return nil, errors.Wrapf(jsonErr, "corrupted cached catalog %s", catalogURL)
+	}
+	return &catalog, err
+}
+
+// fetchKubeconfig downloads the kubeconfig in the catalog into the cache, unless the cached copy is up to date,
+// a cached copy matching the checksum is never downloaded again.
+// If the kubeconfig can not be downloaded, the cached copy is kept, and stale is true if there is one.
+func (c *catalogCache) fetchKubeconfig(catalogURL string, kubeconfig catalogKubeconfig) (stale bool, err error) {
+	base, err := url.Parse(catalogURL)
+	if err != nil {
+		return false, errors.Wrap(err, "url.Parse error")
+	}
+	ref, err := url.Parse(kubeconfig.URL)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid url of %s", kubeconfig.Name)
+	}
+	resolved := base.ResolveReference(ref)
+	u := resolved.String()
+	if resolved.Scheme != "https" && (resolved.Scheme != "http" || kubeconfig.SHA256 == "") {
+		return false, errors.New(t("catalogInsecureKubeconfig", u))
+	}
+
+	path := c.kubeconfigPath(kubeconfig.Name)
+	cachedBody, readErr := os.ReadFile(path)
+	cached := readErr == nil && (kubeconfig.SHA256 == "" || checksumMatches(cachedBody, kubeconfig.SHA256))
+	if cached && kubeconfig.SHA256 != "" {
+		return false, nil // content addressed
+	}
+
+	body, err := c.download(u, cached)
+	if err == nil && body != nil {
+		if kubeconfig.SHA256 != "" && !checksumMatches(body, kubeconfig.SHA256) {
+			delete(c.validators, u)
+			err = errors.New(t("catalogChecksumMismatch", u, kubeconfig.SHA256))
+		} else {
+			err = writeFileAtomic(path, body)
+		}
+	}
+	if err != nil {
+		return cached, errors.Wrapf(err, "download %s error", kubeconfig.Name)
+	}
+	return false, nil
+}
+
+// checksumMatches returns true if the sha256 checksum of content is the hex-encoded sum
+func checksumMatches(content []byte, sum string) bool {
+	actual := sha256.Sum256(content)
+	expected, err := hex.DecodeString(sum)
+	return err == nil && bytes.Equal(actual[:], expected)
+}
+
+// prune removes downloaded kubeconfigs which are no longer in the catalog, except the ones in use,
+// failures are only logged
+func (c *catalogCache) prune(keep map[string]bool, inUse ...string) {
+	root := filepath.Join(c.dir, kubeconfigsDirName)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || keep[path] {
+			return err
+		}
+		for _, p := range inUse {
+			if isSamePath(path, p) {
+				logger.Debugf("Keep %s, which is no longer in the catalog, but in use", path)
+				return nil
+			}
+		}
+		logger.Debugf("Remove %s, which is no longer in the catalog", path)
+		return os.Remove(path)
+	})
+	if err != nil {
+		logger.Debugf("Unable to prune catalog cache %s: %s", c.dir, err)
+	}
+}
+
+// isLocalName returns true if name is a clean relative path, which can not escape the cache dir, like "team/prod"
+func isLocalName(name string) bool {
+	return name != "" && filepath.IsLocal(filepath.FromSlash(name)) && filepath.ToSlash(filepath.Clean(name)) == name
+}
+
+// ListKubeconfigCandidatesInCatalog downloads the kubeconfigs in the catalog of source into its cache dir,
+// and lists them, the metadata is parsed from the downloaded files.
+// Errors of the catalog and each kubeconfig are returned as SourceError, stale if the cached copy is used instead.
+// currentKubeconfigPath and the previous kubeconfig are kept in the cache even if they are no longer in the catalog.
+func ListKubeconfigCandidatesInCatalog(source Source, currentKubeconfigPath string) ([]Candidate, []SourceError) {
+	if !strings.HasPrefix(source.Path, "https://") {
+		return nil, []SourceError{{Source: source.Path, Err: errors.New(t("catalogInsecure", source.Path))}}
+	}
+	cache, err := openCatalogCache(source.Path)
+	if err != nil {
+		return nil, []SourceError{{Source: source.Path, Err: err}}
+	}
+	var sourceErrors []SourceError
+	catalog, err := cache.fetchCatalog(source.Path)
+	if catalog == nil {
+		return nil, []SourceError{{Source: source.Path, Err: err}}
+	}
+	offline := err != nil // cached kubeconfigs are used without requests
+	if offline {
+		logger.Debugf("Using the cached catalog %s: %s", source.Path, err)
+		sourceErrors = append(sourceErrors, SourceError{Source: source.Path, Err: errors.New(t("catalogOffline", err.Error())), Stale: true})
+	}
+
+	var candidates []Candidate
+	keep := map[string]bool{}
+	for _, kubeconfig := range catalog.Kubeconfigs {
+		if !isLocalName(kubeconfig.Name) || keep[cache.kubeconfigPath(kubeconfig.Name)] {
+			logger.Debugf("Skip kubeconfig %q of catalog %s: invalid or duplicated name", kubeconfig.Name, source.Path)
+			continue
+		}
+		path := cache.kubeconfigPath(kubeconfig.Name)
+		keep[path] = true
+		if !offline {
+			stale, err := cache.fetchKubeconfig(source.Path, kubeconfig)
+			if err != nil {
+				sourceErrors = append(sourceErrors, SourceError{Source: source.Path, Err: err, Stale: stale})
+				if !stale {
+					continue
+				}
+			}
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		candidate := Candidate{
+			Name:      source.Prefix + kubeconfig.Name,
+			FullPath:  path,
+			Summary:   kubeconfig.Description,
+			Encrypted: isEncryptedPath(path) || isExternallyEncryptedPath(path),
+			ModTime:   stat.ModTime(),
+		}
+		indexed := indexCandidate(candidate)
+		candidate.Provider, candidate.CurrentContext = indexed.Provider, indexed.CurrentContext
+		candidate.Contexts, candidate.Servers = indexed.Contexts, indexed.Servers
+		candidates = append(candidates, candidate)
+	}
+	if err := cache.save(); err != nil {
+		logger.Debugf("Unable to save validators of catalog %s: %s", source.Path, err)
+	}
+	previous, err := readPreviousKubeconfigPath()
+	if err != nil {
+		logger.Debugf("Unable to read the previous kubeconfig, not pruning catalog %s: %s", source.Path, err)
+		return candidates, sourceErrors
+	}
+	cache.prune(keep, currentKubeconfigPath, previous)
+	return candidates, sourceErrors
+}
+
+// scanCatalogSource lists candidates in the catalog of source, see scanSource
+func scanCatalogSource(source Source, currentKubeconfigPath string) sourceScan {
+	candidates, sourceErrors := ListKubeconfigCandidatesInCatalog(source, currentKubeconfigPath)
+	scan := sourceScan{sourceErrors: sourceErrors}
+	for _, candidate := range candidates {
+		candidate.Source, candidate.Origin = source.Path, source
+		candidate.Tags = config.TagsOf(candidate.Name)
+		scan.candidates = append(scan.candidates, candidate)
+	}
+	return scan
+}
@@ -0,0 +1,192 @@
+package cf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// catalogTestServer serves files over https, conditional on ETag, and counts the requests of each path
+type catalogTestServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	files     map[string]string // by path
+	redirects map[string]string // by path
+	requests  map[string]int    // by path
+}
+
+func newCatalogTestServer(t *testing.T, files map[string]string) *catalogTestServer {
+	s := &catalogTestServer{files: files, redirects: map[string]string{}, requests: map[string]int{}}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests[r.URL.Path]++
+		if location, ok := s.redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+		content, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		sum := sha256.Sum256([]byte(content))
+		etag := `"` + hex.EncodeToString(sum[:4]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(s.Close)
+	transport := catalogTransport
+	t.Cleanup(func() { catalogTransport = transport })
+	catalogTransport = s.Client().Transport
+	t.Cleanup(func() { _ = os.RemoveAll(catalogCacheDir(s.URL + "/catalog.json")) })
+	return s
+}
+
+func (s *catalogTestServer) set(path, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = content
+}
+
+func (s *catalogTestServer) requestsOf(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func candidateNames(candidates []Candidate) []string {
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListKubeconfigCandidatesInCatalog(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("kind: Config\n"))
+	}))
+	defer plain.Close()
+
+	s := newCatalogTestServer(t, map[string]string{
+		"/files/prod.yaml":   "kind: Config\n",
+		"/files/pinned.yaml": "kind: Config\nusers: []\n",
+		"/files/bad.yaml":    "kind: Config\n",
+	})
+	s.redirects["/redirect"] = plain.URL + "/prod.yaml"
+	s.set("/catalog.json", `{"kubeconfigs": [
+  {"name": "prod", "url": "files/prod.yaml"},
+  {"name": "team/pinned", "url": "/files/pinned.yaml", "sha256": "`+checksum("kind: Config\nusers: []\n")+`"},
+  {"name": "bad", "url": "files/bad.yaml", "sha256": "`+checksum("something else")+`"},
+  {"name": "plain", "url": "`+plain.URL+`/prod.yaml"},
+  {"name": "plain-pinned", "url": "`+plain.URL+`/prod.yaml", "sha256": "`+checksum("kind: Config\n")+`"},
+  {"name": "redirect", "url": "/redirect"},
+  {"name": "../escape", "url": "files/prod.yaml"}
+]}`)
+	source := Source{Path: s.URL + "/catalog.json", Prefix: "wiki/"}
+
+	candidates, sourceErrors := ListKubeconfigCandidatesInCatalog(source, "")
+	if got := candidateNames(candidates); len(got) != 3 || got[0] != "wiki/plain-pinned" || got[1] != "wiki/prod" || got[2] != "wiki/team/pinned" {
+		t.Errorf("unexpected candidates %v", got)
+	}
+	if len(sourceErrors) != 3 { // bad checksum, plain http without checksum, redirect to plain http
+		t.Errorf("expect 3 errors, got %v", sourceErrors)
+	}
+	for _, sourceError := range sourceErrors {
+		if sourceError.Stale {
+			t.Errorf("unexpected stale error %s", sourceError.Err)
+		}
+	}
+
+	// unchanged files are not downloaded again, kubeconfigs with checksums are not even requested
+	if _, sourceErrors := ListKubeconfigCandidatesInCatalog(source, ""); len(sourceErrors) != 3 {
+		t.Errorf("expect 3 errors, got %v", sourceErrors)
+	}
+	for path, want := range map[string]int{"/catalog.json": 2, "/files/prod.yaml": 2, "/files/pinned.yaml": 1, "/files/bad.yaml": 2} {
+		if got := s.requestsOf(path); got != want {
+			t.Errorf("expect %d requests of %s, got %d", want, path, got)
+		}
+	}
+	cache, err := openCatalogCache(source.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.validators) == 0 {
+		t.Error("validators are not saved")
+	}
+
+	// a changed file is downloaded again
+	s.set("/files/prod.yaml", "kind: Config\ncontexts: []\n")
+	if _, sourceErrors := ListKubeconfigCandidatesInCatalog(source, ""); len(sourceErrors) != 3 {
+		t.Errorf("expect 3 errors, got %v", sourceErrors)
+	}
+	if f, err := os.ReadFile(cache.kubeconfigPath("prod")); err != nil || string(f) != "kind: Config\ncontexts: []\n" {
+		t.Errorf("prod is not downloaded again: %q, %v", f, err)
+	}
+
+	// kubeconfigs no longer in the catalog are removed, except the current one
+	s.set("/catalog.json", `{"kubeconfigs": []}`)
+	candidates, sourceErrors = ListKubeconfigCandidatesInCatalog(source, cache.kubeconfigPath("team/pinned"))
+	if len(candidates) != 0 || len(sourceErrors) != 0 {
+		t.Errorf("unexpected candidates %v, errors %v", candidates, sourceErrors)
+	}
+	if _, err := os.Stat(cache.kubeconfigPath("prod")); !os.IsNotExist(err) {
+		t.Errorf("prod is not removed: %v", err)
+	}
+	if _, err := os.Stat(cache.kubeconfigPath("team/pinned")); err != nil {
+		t.Errorf("the current kubeconfig is removed: %s", err)
+	}
+}
+
+func TestListKubeconfigCandidatesInCatalogOffline(t *testing.T) {
+	s := newCatalogTestServer(t, map[string]string{
+		"/catalog.json": `{"kubeconfigs": [{"name": "prod", "url": "prod.yaml"}]}`,
+		"/prod.yaml":    "kind: Config\n",
+	})
+	source := Source{Path: s.URL + "/catalog.json"}
+	if candidates, sourceErrors := ListKubeconfigCandidatesInCatalog(source, ""); len(candidates) != 1 || len(sourceErrors) != 0 {
+		t.Fatalf("unexpected candidates %v, errors %v", candidates, sourceErrors)
+	}
+
+	s.Close()
+	candidates, sourceErrors := ListKubeconfigCandidatesInCatalog(source, "")
+	if got := candidateNames(candidates); len(got) != 1 || got[0] != "prod" {
+		t.Errorf("the cached kubeconfig is not listed: %v", got)
+	}
+	if len(sourceErrors) != 1 || !sourceErrors[0].Stale {
+		t.Errorf("expect a stale error, got %v", sourceErrors)
+	}
+}
+
+func TestListKubeconfigCandidatesInCatalogRequiresHTTPS(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"kubeconfigs": []}`))
+	}))
+	defer s.Close()
+
+	candidates, sourceErrors := ListKubeconfigCandidatesInCatalog(Source{Path: s.URL + "/catalog.json"}, "")
+	if len(candidates) != 0 || len(sourceErrors) != 1 {
+		t.Errorf("unexpected candidates %v, errors %v", candidates, sourceErrors)
+	}
+	if requests != 0 {
+		t.Errorf("a plain http catalog is requested %d times", requests)
+	}
+}
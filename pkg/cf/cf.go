@@ -2,8 +2,10 @@ package cf
 
 import (
 	"flag"
+	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/junchaw/kubectl-cf/pkg/log"
@@ -21,14 +23,90 @@ const (
 	// read kubeconfig files from the directory of the given kubeconfig file.
 	KubeconfigSpecialPathKubeconfigDir = "@kubeconfig-dir"
 
+	// RecursiveSourceSuffix is the suffix of a source path to scan its subdirectories, like "~/kube/**"
+	RecursiveSourceSuffix = "/**"
+
+	// SourceTimeoutDefault is how long a source may take to scan by default, before it is marked as stale
+	SourceTimeoutDefault = 3 * time.Second
+
+	// RecursiveMaxDepthDefault is the default depth of subdirectories to scan in a recursive source
+	RecursiveMaxDepthDefault = 5
+
 	// KubeconfigFilenameMatchPatternStrDefault is the default regex pattern for kubeconfig filename
 	KubeconfigFilenameMatchPatternStrDefault = `^(?P<name>(config)|([^\.]+\.yaml))$`
 
+	// DecryptFilenameMatchPatternStrDefault is the default regex pattern for the filename of kubeconfig files
+	// encrypted by an external tool, like sops, they are decrypted by the decrypt command before switching
+	DecryptFilenameMatchPatternStrDefault = `\.enc\.(yaml|yml|json)$`
+
+	// DecryptCommandDefault is the default command to decrypt kubeconfig files encrypted by an external tool
+	DecryptCommandDefault = "sops --decrypt"
+
+	// DecryptCommandTimeout is the maximal time the decrypt command may take
+	DecryptCommandTimeout = 30 * time.Second
+
+	// ExecCommandTimeout is the maximal time the command of an exec source may take
+	ExecCommandTimeout = 30 * time.Second
+
+	// CatalogRequestTimeout is the maximal time a request to download a catalog or a kubeconfig in it may take
+	CatalogRequestTimeout = 30 * time.Second
+
+	// DecryptCacheTTLDefault is how long the output of the decrypt command is reused by default
+	DecryptCacheTTLDefault = time.Hour
+
 	// KubeconfigFilenameMatchPatternNameGroup is the name of the regex group for kubeconfig name, "(?P<name>...)"
 	KubeconfigFilenameMatchPatternNameGroup = "name"
 
 	// PreviousKubeconfigFullPath is the file name which stores the previous kubeconfig file's full path
 	PreviousKubeconfigFullPath = "previous"
+
+	// TrashDirName is the name of the directory in kubectl-cf config dir,
+	// deleted kubeconfig files are moved into it instead of being unlinked
+	TrashDirName = "trash"
+
+	// CatalogsDirName is the name of the directory in kubectl-cf config dir,
+	// kubeconfigs in catalogs are downloaded into it, see isCatalogURL
+	CatalogsDirName = "catalogs"
+
+	// ConfigFileName is the name of the config file in kubectl-cf config dir, see Config
+	ConfigFileName = "config.yaml"
+
+	// IndexFileName is the name of the file in kubectl-cf config dir, which caches the kubeconfig files found in directories
+	IndexFileName = "index"
+
+	// UsageFileName is the name of the file in kubectl-cf config dir, which stores the usage statistics
+	UsageFileName = "usage"
+
+	// UsageLockFileName is the name of the file in kubectl-cf config dir, which is locked while recording usage,
+	// so concurrent kubectl-cf processes never lose each other's counts
+	UsageLockFileName = "usage.lock"
+
+	// JournalFileName is the name of the file in kubectl-cf config dir, which records the filesystem mutations
+	// made by kubectl-cf, used by "cf undo", see JournalMaxEntries
+	JournalFileName = "journal"
+
+	// JournalLockFileName is the name of the file in kubectl-cf config dir, which is locked while writing the journal
+	JournalLockFileName = "journal.lock"
+
+	// JournalMaxEntries is the maximal number of operations kept in the journal, older operations are dropped
+	JournalMaxEntries = sys.MaxBackUpRevisions
+
+	// EncryptedFileSuffix is the suffix of encrypted kubeconfig files, like "prod.yaml.cfenc",
+	// the suffix is stripped before matching kubeconfigFilenameMatchPattern
+	EncryptedFileSuffix = ".cfenc"
+
+	// KeyFileName is the name of the key file in kubectl-cf config dir, used to encrypt and decrypt kubeconfig files
+	KeyFileName = "key"
+
+	// DecryptedIndexFileName is the name of the file in kubectl-cf config dir,
+	// which maps decrypted runtime files to their encrypted kubeconfig files
+	DecryptedIndexFileName = "decrypted"
+
+	// ConfigDirMode is the mode of kubectl-cf config dir and the directories in it
+	ConfigDirMode os.FileMode = 0700
+
+	// ConfigFileMode is the mode of files written by kubectl-cf, like the previous file and the journal
+	ConfigFileMode os.FileMode = 0600
 )
 
 var logger = log.DefaultLogger
@@ -40,6 +118,7 @@ var (
 	warning = term.MakeFgStyle("1")   // red
 	info    = term.MakeFgStyle("28")  // blue
 	text    = term.MakeFgStyle("255") // white
+	subtle  = term.MakeFgStyle("245") // gray
 )
 
 var (
@@ -49,10 +128,34 @@ var (
 	// kubectlCfConfigDir is the directory for kubectl-cf config files
 	kubectlCfConfigDir           = "" // will be set in init()
 	previousKubeconfigConfigPath = "" // will be set in init()
-
-	// kubeconfigDirPaths is the list of kubeconfig paths,
-	// parsed from environment variable KUBECTL_CF_PATHS, works like PATH environment variable
-	kubeconfigDirPaths = []string{} // will be set in init()
+	trashDirPath                 = "" // will be set in init()
+	catalogsDirPath              = "" // will be set in init()
+	journalPath                  = "" // will be set in init()
+	journalLockPath              = "" // will be set in init()
+	configPath                   = "" // will be set in init()
+	usagePath                    = "" // will be set in init()
+	usageLockPath                = "" // will be set in init()
+	indexPath                    = "" // will be set in init()
+	decryptedIndexPath           = "" // will be set in init()
+
+	// keyFilePath is the key file for encrypted kubeconfig files,
+	// it can be overridden by environment variable KUBECTL_CF_KEY_FILE
+	keyFilePath = "" // will be set in init()
+
+	// kubeconfigSources is the list of sources of kubeconfig files, parsed from environment variable KUBECTL_CF_PATHS,
+	// which works like PATH environment variable, followed by the sources in the config file
+	kubeconfigSources = []Source{} // will be set in init()
+
+	// defaultDetectMode is how kubeconfig files are detected in sources without a detection mode, see Source.Detect,
+	// it can be overridden by environment variable KUBECTL_CF_DETECT
+	defaultDetectMode = DetectPattern // will be set in init()
+
+	// sourceTimeout is how long a source may take to scan, before it is marked as stale, see Source.Timeout,
+	// it can be overridden by environment variable KUBECTL_CF_SOURCE_TIMEOUT
+	sourceTimeout = SourceTimeoutDefault // will be set in init()
+
+	// defaultExcludes are excluded in all sources, see Source.Exclude
+	defaultExcludes = []string{"cache/", "http-cache/"}
 
 	// kubeconfigDir is the directory for kubeconfig, for example, ~/.kube
 	kubeconfigDir = "" // will be set in init()
@@ -64,12 +167,46 @@ var (
 	// it comes with a default value,
 	// and can be overriden by environment variable KUBECONFIG_FILENAME_MATCH_PATTERN
 	kubeconfigFilenameMatchPattern *regexp.Regexp = nil // will be set in init()
+
+	// relativeSymlinks makes the kubeconfig symlink relative when the target is inside the directory of the kubeconfig,
+	// so that synced kubeconfig directories work across machines with different home paths,
+	// it can be enabled by environment variable KUBECTL_CF_RELATIVE_SYMLINKS
+	relativeSymlinks = false // will be set in init()
+
+	// config is loaded from the config file, an invalid config file is ignored with a warning
+	config = &Config{} // will be set in init()
+
+	// defaultSortMode is the sort mode of the list when started, from the config file,
+	// it can be overridden by environment variable KUBECTL_CF_SORT
+	defaultSortMode = SortByName // will be set in init()
+
+	// decryptFilenameMatchPattern defines the filename pattern of kubeconfig files encrypted by an external tool,
+	// it can be overridden by environment variable KUBECTL_CF_DECRYPT_MATCH_PATTERN
+	decryptFilenameMatchPattern *regexp.Regexp = nil // will be set in init()
+
+	// decryptCommand decrypts kubeconfig files matching decryptFilenameMatchPattern, and prints to stdout,
+	// it can be overridden by environment variable KUBECTL_CF_DECRYPT_COMMAND
+	decryptCommand = "" // will be set in init()
+
+	// decryptInteractive is true if decryptCommand may prompt for a passphrase or a PIN, like gpg with pinentry,
+	// it runs in the terminal while the list is suspended, instead of in the background,
+	// it can be set by environment variable KUBECTL_CF_DECRYPT_INTERACTIVE
+	decryptInteractive = false // will be set in init()
+
+	// decryptCacheTTL is how long the output of decryptCommand is reused, 0 disables the cache,
+	// it can be overridden by environment variable KUBECTL_CF_DECRYPT_CACHE_TTL
+	decryptCacheTTL time.Duration = 0 // will be set in init()
 )
 var Modal = &KubectlCfModal{}
 
 func Run() error {
 	flag.Parse()
 
+	if c, ok := commands[flag.Arg(0)]; ok && (!c.needsArgs || flag.NArg() > 1) {
+		runCommand(flag.Arg(0), c, flag.Args()[1:])
+		return nil
+	}
+
 	p := tea.NewProgram(Modal)
 
 	_, err := p.Run()
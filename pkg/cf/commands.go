@@ -0,0 +1,119 @@
+package cf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// command is a subcommand of kubectl-cf, for example, "cf diff a b"
+type command struct {
+	// args describes the arguments, for example, "<a> <b>", used in error messages
+	args string
+
+	// nArgs is the number of arguments the command expects, -1 means any number
+	nArgs int
+
+	// needsArgs is true if the command is only dispatched with arguments,
+	// when its name is also a common kubeconfig name, like "config"
+	needsArgs bool
+
+	// confirm is true if the command modifies files without arguments, it asks for confirmation unless "--yes" is given,
+	// since its name may be meant as a kubeconfig name, like "reset"
+	confirm bool
+
+	// confirmDetail returns what the command with args is about to do, shown before the confirmation, optional
+	confirmDetail func(args []string) string
+
+	run func(args []string) error
+}
+
+// commands are the subcommands of kubectl-cf, keyed by name, they take precedence over kubeconfig names.
+// A kubeconfig with the same name as a command can still be selected interactively, or by its full file name.
+var commands = map[string]command{
+	"diff":    {args: "<kubeconfig> <kubeconfig>", nArgs: 2, needsArgs: true, run: runDiff},
+	"backups": {args: backupsArgs, nArgs: -1, run: runBackups},
+	"undo":    {args: "[--yes]", nArgs: 0, confirm: true, run: runUndo},
+	"reset":   {args: resetArgs, nArgs: -1, confirm: true, confirmDetail: resetConfirmDetail, run: runReset},
+	"harden":  {args: "[--dry-run] [--yes]", nArgs: -1, confirm: true, run: runHarden},
+	"keygen":  {nArgs: 0, run: runKeygen},
+	"encrypt": {args: encryptArgs, nArgs: -1, needsArgs: true, run: runEncrypt},
+	"decrypt": {args: "<kubeconfig>", nArgs: 1, needsArgs: true, run: runDecrypt},
+	"config":  {args: configArgs, nArgs: -1, needsArgs: true, run: runConfig},
+	"list":    {nArgs: 0, run: runList},
+	"index":   {args: indexArgs, nArgs: -1, needsArgs: true, run: runIndex},
+}
+
+// runCommand runs the command with args, errors are printed and the program exits with code 1
+func runCommand(name string, c command, args []string) {
+	if c.confirm {
+		yes := slices.Contains(args, "--yes")
+		args = slices.DeleteFunc(args, func(arg string) bool { return arg == "--yes" })
+		if !yes && c.confirmDetail != nil {
+			if detail := c.confirmDetail(args); detail != "" {
+				fmt.Println(warning(detail))
+			}
+		}
+		if !yes && !slices.Contains(args, "--dry-run") && !confirmCommand(name) { // a dry run never modifies files
+			fmt.Println(t("commandCanceled"))
+			return
+		}
+	}
+	err := errors.New(t("commandUsage", name, c.args))
+	if c.nArgs < 0 || len(args) == c.nArgs {
+		err = c.run(args)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, warning(err.Error()))
+		os.Exit(1)
+	}
+}
+
+// confirmCommand asks whether to run the command, returns false unless "y" is entered
+func confirmCommand(name string) bool {
+	fmt.Print(t("confirmCommand", name, name))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.TrimSpace(answer) {
+	case "y", "Y", "yes":
+		return true
+	}
+	return false
+}
+
+// loadCandidates lists candidates the same way as the interactive mode does,
+// sources which can not be read are logged as warnings
+func loadCandidates() (Candidates, error) {
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+	candidates, sourceErrors := ListKubeconfigCandidates(currentKubeconfigPath)
+	for _, sourceError := range sourceErrors {
+		logger.Warn(sourceError.Error())
+	}
+	return candidates, nil
+}
+
+// resolveKubeconfigArg resolves arg to a kubeconfig file path,
+// arg can be the name (or name prefix) of a candidate, or a path to a file
+func resolveKubeconfigArg(candidates Candidates, arg string) (string, error) {
+	guessCandidates := candidates.Guess(arg)
+	if len(guessCandidates) == 1 {
+		return guessCandidates[0].FullPath, nil
+	}
+	if stat, err := os.Stat(arg); err == nil && !stat.IsDir() {
+		return arg, nil
+	}
+	if guessCandidates == nil {
+		return "", errors.New(t("noMatchFound", arg))
+	}
+	var names []string
+	for _, g := range guessCandidates {
+		names = append(names, g.DisplayName())
+	}
+	return "", errors.New(t("moreThanOneMatchesFound", arg, strings.Join(names, ", ")))
+}
@@ -0,0 +1,55 @@
+package cf
+
+import (
+	"os"
+	"path"
+	"slices"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of the config file in kubectl-cf config dir, all fields are optional
+type Config struct {
+	// Tags maps patterns of candidate names to tags, patterns are matched by path.Match,
+	// for example, "prod-*": ["production"]
+	Tags map[string][]string `yaml:"tags,omitempty"`
+
+	// Sort is the default sort mode of the list, like "name" or "last-used", see sortModes
+	Sort string `yaml:"sort,omitempty"`
+
+	// Sources are read after the sources in environment variable KUBECTL_CF_PATHS
+	Sources []Source `yaml:"sources,omitempty"`
+}
+
+// LoadConfig reads the config file, an empty config is returned if the config file not exist
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	f, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if err := yaml.Unmarshal(f, c); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", path)
+	}
+	return c, nil
+}
+
+// TagsOf returns the sorted tags of the candidate with name
+func (c *Config) TagsOf(name string) []string {
+	var tags []string
+	for pattern, patternTags := range c.Tags {
+		if matched, _ := path.Match(pattern, name); matched {
+			for _, tag := range patternTags {
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
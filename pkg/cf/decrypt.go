@@ -0,0 +1,226 @@
+package cf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+// isExternallyEncryptedPath returns true if path is a kubeconfig encrypted by an external tool like sops,
+// which is decrypted by decryptCommand
+func isExternallyEncryptedPath(path string) bool {
+	return decryptFilenameMatchPattern.MatchString(filepath.Base(path))
+}
+
+// decryptCommandArgs returns the decrypt command for path,
+// "{}" in the command is replaced by path, if there is no "{}", path is appended
+func decryptCommandArgs(path string) []string {
+	args := strings.Fields(decryptCommand)
+	replaced := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{}") {
+			args[i] = strings.ReplaceAll(arg, "{}", path)
+			replaced = true
+		}
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	return args
+}
+
+// decryptWithCommand runs the decrypt command for path, returns the decrypted content printed to stdout
+func decryptWithCommand(path string) ([]byte, error) {
+	args := decryptCommandArgs(path)
+	if len(args) < 2 {
+		return nil, errors.New(t("noDecryptCommand"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DecryptCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New(t("decryptCommandTimeout", strings.Join(args, " "), DecryptCommandTimeout))
+		}
+		return nil, errors.New(t("decryptCommandError", strings.Join(args, " "), err.Error(), strings.TrimSpace(stderr.String())))
+	}
+	return stdout.Bytes(), nil
+}
+
+// decryptCacheDir returns the directory in the runtime dir for decrypted kubeconfig files which are reused until expired
+func decryptCacheDir() string {
+	return filepath.Join(runtimeDir(), "cache")
+}
+
+// isCacheFile returns true if path is in decryptCacheDir
+func isCacheFile(path string) bool {
+	return filepath.Dir(path) == decryptCacheDir()
+}
+
+// cacheFileTime returns the time when the cache file was decrypted, which is encoded in its name,
+// the modification time can not be used since creating the kubeconfig symlink touches its target
+func cacheFileTime(path string) (time.Time, bool) {
+	parts := strings.SplitN(filepath.Base(path), "-", 3)
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// cacheFileExpired returns true if the cache file was decrypted more than decryptCacheTTL ago, or not exist
+func cacheFileExpired(path string) bool {
+	decryptedAt, ok := cacheFileTime(path)
+	if !ok || time.Since(decryptedAt) > decryptCacheTTL {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err != nil
+}
+
+// decryptToCacheFile decrypts the externally encrypted kubeconfig at path with the decrypt command,
+// the output is cached in a private file for decryptCacheTTL, returns the path of the cache file.
+// If decryptCacheTTL is 0, the output is not cached, and it is wiped on the next switch like other runtime files.
+func decryptToCacheFile(path string) (string, error) {
+	if cachePath, ok := cachedDecryptedFile(path); ok {
+		return cachePath, nil
+	}
+	plaintext, err := decryptWithCommand(path)
+	if err != nil {
+		return "", err
+	}
+	return storeDecryptedOutput(path, plaintext)
+}
+
+// decryptInTerminal decrypts the externally encrypted kubeconfig at path like decryptToCacheFile,
+// but the decrypt command runs in the terminal while the program is suspended, without a timeout,
+// so it can prompt for a passphrase or a PIN, see decryptInteractive
+func decryptInTerminal(path string) tea.Cmd {
+	if cachePath, ok := cachedDecryptedFile(path); ok {
+		return func() tea.Msg { return runtimeTargetMsg{path: path, target: cachePath} }
+	}
+	args := decryptCommandArgs(path)
+	if len(args) < 2 {
+		return func() tea.Msg { return runtimeTargetMsg{path: path, err: errors.New(t("noDecryptCommand"))} }
+	}
+	var stdout bytes.Buffer
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdout = &stdout // stdin and stderr are the terminal
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			err = errors.New(t("decryptKubeconfigError", t("decryptCommandFailed", strings.Join(args, " "), err.Error())))
+			return runtimeTargetMsg{path: path, err: err}
+		}
+		cachePath, err := storeDecryptedOutput(path, stdout.Bytes())
+		if err != nil {
+			err = errors.New(t("decryptKubeconfigError", err.Error()))
+		}
+		return runtimeTargetMsg{path: path, target: cachePath, err: err}
+	})
+}
+
+// cachedDecryptedFile returns the cache file of the externally encrypted kubeconfig at path,
+// false if it is not cached, expired, or older than the encrypted file
+func cachedDecryptedFile(path string) (string, bool) {
+	if decryptCacheTTL <= 0 {
+		return "", false
+	}
+	sourceStat, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	index, err := readDecryptedIndex()
+	if err != nil {
+		logger.Debugf("Unable to read index of decrypted files: %s", err)
+		return "", false
+	}
+	for cachePath, source := range index {
+		if source != path || !isCacheFile(cachePath) || cacheFileExpired(cachePath) {
+			continue
+		}
+		if decryptedAt, _ := cacheFileTime(cachePath); !decryptedAt.Before(sourceStat.ModTime().Truncate(time.Second)) {
+			logger.Debugf("Using cached decrypted kubeconfig %s", cachePath)
+			return cachePath, true
+		}
+	}
+	return "", false
+}
+
+// storeDecryptedOutput saves plaintext, the output of the decrypt command for path, in a cache file,
+// or in a runtime file if decryptCacheTTL is 0, returns the path of the file
+func storeDecryptedOutput(path string, plaintext []byte) (string, error) {
+	if decryptCacheTTL <= 0 {
+		return writeRuntimeFile(path, plaintext)
+	}
+
+	if _, err := ensureRuntimeDir(); err != nil {
+		return "", err
+	}
+	dir := decryptCacheDir()
+	if err := os.MkdirAll(dir, ConfigDirMode); err != nil {
+		return "", errors.Wrap(err, "create cache dir error")
+	}
+	index, err := readDecryptedIndex()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, ".tmp-*") // created with mode 0600
+	if err != nil {
+		return "", errors.Wrap(err, "os.CreateTemp error")
+	}
+	if _, err := f.Write(plaintext); err != nil {
+		_ = f.Close()
+		_ = sys.WipeFile(f.Name())
+		return "", errors.Wrap(err, "write cache file error")
+	}
+	if err := f.Close(); err != nil {
+		_ = sys.WipeFile(f.Name())
+		return "", errors.Wrap(err, "close cache file error")
+	}
+	sum := sha256.Sum256([]byte(path))
+	cachePath := filepath.Join(dir, fmt.Sprintf("%s-%d-%s", hex.EncodeToString(sum[:4]), time.Now().Unix(), filepath.Base(path)))
+	if err := os.Rename(f.Name(), cachePath); err != nil { // kubectl never sees a partially written file
+		_ = sys.WipeFile(f.Name())
+		return "", errors.Wrap(err, "os.Rename error")
+	}
+
+	index[cachePath] = path
+	if err := writeDecryptedIndex(index); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
+
+// sweepExpiredCacheFiles wipes expired cache files, except the one in use by the kubeconfig symlink
+func sweepExpiredCacheFiles(inUse string) {
+	index, err := readDecryptedIndex()
+	if err != nil {
+		logger.Debugf("Unable to read index of decrypted files: %s", err)
+		return
+	}
+	for path := range index {
+		if isCacheFile(path) && !isSamePath(path, inUse) && cacheFileExpired(path) {
+			if err := wipeRuntimeFile(path); err != nil {
+				logger.Warnf("Unable to wipe expired decrypted kubeconfig %s: %s", path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cf
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSwitchDecryptsInBackground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test decrypt command is cat")
+	}
+	defer func(command string, interactive bool) { decryptCommand, decryptInteractive = command, interactive }(decryptCommand, decryptInteractive)
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.yaml", "a")
+	encrypted := writeTestFile(t, dir, "b.enc.yaml", "kind: Config\n")
+	resetKubeconfigSymlink(t, a)
+
+	for _, c := range []struct {
+		name        string
+		command     string
+		interactive bool
+		ok          bool
+	}{
+		{name: "failing command", command: "false", ok: false},
+		{name: "background", command: "cat", ok: true},
+		{name: "cached, interactive", command: "false", interactive: true, ok: true}, // the command is not run again
+	} {
+		decryptCommand, decryptInteractive = c.command, c.interactive
+		modal := &KubectlCfModal{currentKubeconfigPath: a}
+		cmd := modal.startSwitch(encrypted)
+		if modal.mode != ModeSwitching {
+			t.Fatalf("%s: mode is %d before the kubeconfig is decrypted, want ModeSwitching", c.name, modal.mode)
+		}
+		msg, ok := cmd().(runtimeTargetMsg)
+		if !ok {
+			t.Fatalf("%s: expect a runtimeTargetMsg", c.name)
+		}
+		modal.Update(msg)
+		if modal.mode != ModeQuit {
+			t.Errorf("%s: mode is %d after the kubeconfig is decrypted, want ModeQuit", c.name, modal.mode)
+		}
+
+		target := readLink(t, kubeconfigPath)
+		if !c.ok {
+			if target != a || !strings.Contains(modal.farewell, "false") {
+				t.Errorf("%s: symlink points to %s, farewell %q, want %s and the error", c.name, target, modal.farewell, a)
+			}
+			continue
+		}
+		if content, err := os.ReadFile(target); err != nil || string(content) != "kind: Config\n" || !isCacheFile(target) {
+			t.Errorf("%s: symlink points to %s: %q, %v, want the decrypted cache file", c.name, target, content, err)
+		}
+	}
+}
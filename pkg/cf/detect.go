@@ -0,0 +1,94 @@
+package cf
+
+import (
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/junchaw/kubectl-cf/pkg/crypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Detection modes of kubeconfig files in a source, see Source.Detect
+const (
+	// DetectPattern detects kubeconfig files by kubeconfigFilenameMatchPattern only
+	DetectPattern = "pattern"
+
+	// DetectContent detects kubeconfig files by their content only, named by the file name, see looksLikeKubeconfig
+	DetectContent = "content"
+
+	// DetectBoth detects kubeconfig files matching kubeconfigFilenameMatchPattern and looking like kubeconfig
+	DetectBoth = "both"
+)
+
+// detectModes are all detection modes
+var detectModes = []string{DetectPattern, DetectContent, DetectBoth}
+
+// sniffTimeout is SniffTimeout, overridden in tests
+var sniffTimeout = SniffTimeout
+
+const (
+	// SniffSizeLimit is the maximal size of a file to sniff, larger files are never kubeconfig files
+	SniffSizeLimit = 1 << 20
+
+	// SniffTimeout is the maximal time to parse a file when sniffing
+	SniffTimeout = time.Second
+)
+
+// isDetectMode returns true if mode is one of detectModes
+func isDetectMode(mode string) bool {
+	return slices.Contains(detectModes, mode)
+}
+
+// sniffFields are the top-level fields of a file to tell whether it is a kubeconfig,
+// values may be encrypted by tools like sops, which keep keys in plaintext
+type sniffFields struct {
+	APIVersion any `yaml:"apiVersion"`
+	Kind       any `yaml:"kind"`
+	Clusters   any `yaml:"clusters"`
+	Contexts   any `yaml:"contexts"`
+}
+
+// looksLikeKubeconfig sniffs the file at path, returns true if it is encrypted by kubectl-cf,
+// or it is a YAML (or JSON) document of "kind: Config" with "apiVersion: v1", or with both clusters and contexts,
+// files larger than SniffSizeLimit or taking longer than SniffTimeout to parse are not kubeconfig files
+func looksLikeKubeconfig(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		logger.Debugf("Unable to sniff %s: %s", path, err)
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	content, err := io.ReadAll(io.LimitReader(f, SniffSizeLimit+1))
+	if err != nil || len(content) > SniffSizeLimit {
+		logger.Debugf("Skip sniffing %s: unreadable or larger than %d bytes", path, SniffSizeLimit)
+		return false
+	}
+	if crypt.IsEncrypted(content) {
+		return true
+	}
+
+	parsed := make(chan *sniffFields, 1) // buffered, the parser never blocks after a timeout
+	go func() {
+		var fields sniffFields
+		if err := yaml.Unmarshal(content, &fields); err != nil {
+			parsed <- nil
+			return
+		}
+		parsed <- &fields
+	}()
+	select {
+	case fields := <-parsed:
+		if fields == nil {
+			return false
+		}
+		if fields.Kind == "Config" && (fields.APIVersion == nil || fields.APIVersion == "v1") {
+			return true
+		}
+		return fields.Clusters != nil && fields.Contexts != nil
+	case <-time.After(sniffTimeout):
+		logger.Debugf("Skip sniffing %s: parsing takes longer than %s", path, sniffTimeout)
+		return false
+	}
+}
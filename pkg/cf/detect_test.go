@@ -0,0 +1,65 @@
+package cf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLooksLikeKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		content string
+		want    bool
+	}{
+		{"apiVersion: v1\nkind: Config\n", true},
+		{"kind: Config\n", true},
+		{"apiVersion: v2\nkind: Config\n", false},
+		{"clusters: []\ncontexts: []\n", true},
+		{"clusters: []\n", false},
+		{`{"kind": "Config", "apiVersion": "v1"}`, true},
+		{"apiVersion: v1\nkind: Pod\n", false},
+		{"kind: [Config\n", false},
+		{"clusters: ENC[AES256_GCM,data:abc]\ncontexts: ENC[AES256_GCM,data:def]\nsops: {}\n", true}, // encrypted values
+		{"", false},
+	} {
+		path := writeTestFile(t, dir, "sniff", c.content)
+		if got := looksLikeKubeconfig(path); got != c.want {
+			t.Errorf("looksLikeKubeconfig(%q) = %v, want %v", c.content, got, c.want)
+		}
+	}
+
+	if !looksLikeKubeconfig(writeEncryptedTestFile(t, dir, "encrypted", "not a kubeconfig")) {
+		t.Error("a file encrypted by kubectl-cf is not sniffed as kubeconfig")
+	}
+	if looksLikeKubeconfig(dir + "/missing") {
+		t.Error("a missing file is sniffed as kubeconfig")
+	}
+}
+
+func TestLooksLikeKubeconfigLimits(t *testing.T) {
+	t.Cleanup(func() { sniffTimeout = SniffTimeout })
+	dir := t.TempDir()
+	padded := func(size int) string {
+		content := "kind: Config\n#"
+		return content + strings.Repeat("x", size-len(content))
+	}
+	list := "kind: Config\nclusters:\n" + strings.Repeat("- a\n", SniffSizeLimit/8)
+
+	for _, c := range []struct {
+		name    string
+		content string
+		timeout time.Duration
+		want    bool
+	}{
+		{"at the size limit", padded(SniffSizeLimit), SniffTimeout, true},
+		{"over the size limit", padded(SniffSizeLimit + 1), SniffTimeout, false},
+		{"parsed in time", list, SniffTimeout, true},
+		{"parsing timed out", list, time.Nanosecond, false},
+	} {
+		sniffTimeout = c.timeout
+		if got := looksLikeKubeconfig(writeTestFile(t, dir, "sniff", c.content)); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
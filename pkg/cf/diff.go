@@ -0,0 +1,343 @@
+package cf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/junchaw/kubectl-cf/pkg/crypt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// secretFields are the kubeconfig fields whose values are never shown,
+// only their fingerprints are compared
+var secretFields = map[string]bool{
+	"token":                      true,
+	"password":                   true,
+	"client-key-data":            true,
+	"client-certificate-data":    true,
+	"certificate-authority-data": true,
+	"id-token":                   true,
+	"refresh-token":              true,
+	"access-token":               true,
+	"client-secret":              true,
+}
+
+// diffSections are the named lists in kubeconfig which are compared item by item,
+// mapped to the key of the item body, for example, clusters[].cluster
+var diffSections = []struct {
+	name, body string
+}{
+	{"clusters", "cluster"},
+	{"contexts", "context"},
+	{"users", "user"},
+}
+
+// FieldDiff is a changed field of a kubeconfig item
+type FieldDiff struct {
+	Field string
+	Old   string
+	New   string
+
+	// OldSet and NewSet are false if the field is added or removed, an empty value is still set
+	OldSet bool
+	NewSet bool
+}
+
+// ItemDiff is a changed item (cluster, context or user) of a kubeconfig
+type ItemDiff struct {
+	Section string
+	Name    string
+
+	// Change is one of "+" (added), "-" (removed) or "~" (modified)
+	Change string
+
+	// Fields are the changed fields, only set if the item is modified
+	Fields []FieldDiff
+}
+
+// KubeconfigDiff is the semantic difference between two kubeconfigs
+type KubeconfigDiff struct {
+	CurrentContext *FieldDiff
+	Items          []ItemDiff
+}
+
+// Empty returns true if there is no difference
+func (d KubeconfigDiff) Empty() bool {
+	return d.CurrentContext == nil && len(d.Items) == 0
+}
+
+// fingerprint returns a short hash of a secret, so secrets can be compared without being shown
+func fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// isSecretArg returns true if the command line flag, like "--token" or "--client-secret=...", takes a secret
+func isSecretArg(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	name, _, _ := strings.Cut(strings.ToLower(strings.TrimLeft(arg, "-")), "=")
+	return secretFields[name] || strings.Contains(name, "token") || strings.Contains(name, "password") || strings.Contains(name, "secret")
+}
+
+// fingerprintArgs replaces the values of secret flags in the args of an exec plugin by their fingerprints,
+// like "--token=abc" and "--password abc"
+func fingerprintArgs(args []any) []any {
+	fingerprinted := make([]any, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		switch {
+		case !ok:
+			fingerprinted[i] = arg
+		case isSecretArg(s) && strings.Contains(s, "="):
+			name, value, _ := strings.Cut(s, "=")
+			fingerprinted[i] = name + "=" + fingerprint(value)
+		case i > 0 && !strings.HasPrefix(s, "-") && fingerprinted[i-1] == args[i-1] && isSecretArg(fmt.Sprint(args[i-1])) &&
+			!strings.Contains(fmt.Sprint(args[i-1]), "="):
+			fingerprinted[i] = fingerprint(s) // the value of the previous flag
+		default:
+			fingerprinted[i] = s
+		}
+	}
+	return fingerprinted
+}
+
+// flatten flattens value into fields like "exec.args[0]", secrets are replaced by their fingerprints,
+// including secret flags in exec args, and credentials in server and proxy URLs are stripped like in the preview
+func flatten(prefix string, value any, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			field := k
+			if prefix != "" {
+				field = prefix + "." + k
+			}
+			s, isString := child.(string)
+			switch {
+			case isString && (secretFields[k] || (k == "value" && strings.HasPrefix(prefix, "exec.env"))):
+				fields[field] = fingerprint(s)
+			case isString && (field == "server" || field == "proxy-url"):
+				fields[field] = redactURL(s)
+			default:
+				if args, ok := child.([]any); ok && field == "exec.args" {
+					child = fingerprintArgs(args)
+				}
+				flatten(field, child, fields)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, fields)
+		}
+	default:
+		fields[prefix] = fmt.Sprint(v)
+	}
+}
+
+// namedItems indexes the items of a section by name, with flattened bodies
+func namedItems(kubeconfig map[string]any, section, body string) map[string]map[string]string {
+	items := map[string]map[string]string{}
+	list, _ := kubeconfig[section].([]any)
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		name := fmt.Sprint(m["name"])
+		fields := map[string]string{}
+		flatten("", m[body], fields)
+		items[name] = fields
+	}
+	return items
+}
+
+// diffFields compares two flattened items
+func diffFields(a, b map[string]string) []FieldDiff {
+	var diffs []FieldDiff
+	for field, old := range a {
+		if n, ok := b[field]; !ok || n != old {
+			diffs = append(diffs, FieldDiff{Field: field, Old: old, New: n, OldSet: true, NewSet: ok})
+		}
+	}
+	for field, n := range b {
+		if _, ok := a[field]; !ok {
+			diffs = append(diffs, FieldDiff{Field: field, New: n, NewSet: true})
+		}
+	}
+	slices.SortFunc(diffs, func(x, y FieldDiff) int { return strings.Compare(x.Field, y.Field) })
+	return diffs
+}
+
+// DiffKubeconfigs compares clusters, contexts and users of two kubeconfigs by name
+func DiffKubeconfigs(a, b map[string]any) KubeconfigDiff {
+	var diff KubeconfigDiff
+	ca, _ := a["current-context"].(string)
+	cb, _ := b["current-context"].(string)
+	if ca != cb {
+		diff.CurrentContext = &FieldDiff{Field: "current-context", Old: ca, New: cb, OldSet: true, NewSet: true}
+	}
+	for _, section := range diffSections {
+		itemsA := namedItems(a, section.name, section.body)
+		itemsB := namedItems(b, section.name, section.body)
+		var names []string
+		for name := range itemsA {
+			names = append(names, name)
+		}
+		for name := range itemsB {
+			if _, ok := itemsA[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			itemA, inA := itemsA[name]
+			itemB, inB := itemsB[name]
+			switch {
+			case !inA:
+				diff.Items = append(diff.Items, ItemDiff{Section: section.name, Name: name, Change: "+"})
+			case !inB:
+				diff.Items = append(diff.Items, ItemDiff{Section: section.name, Name: name, Change: "-"})
+			default:
+				if fields := diffFields(itemA, itemB); fields != nil {
+					diff.Items = append(diff.Items, ItemDiff{Section: section.name, Name: name, Change: "~", Fields: fields})
+				}
+			}
+		}
+	}
+	return diff
+}
+
+// readKubeconfigMap reads a kubeconfig file as a generic map, so unknown fields are compared as well
+func readKubeconfigMap(path string) (map[string]any, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if crypt.IsEncrypted(f) || isExternallyEncryptedPath(path) {
+		return nil, errors.New(t("kubeconfigIsEncrypted", path))
+	}
+	kubeconfig := map[string]any{}
+	if err := yaml.Unmarshal(f, &kubeconfig); err != nil {
+		return nil, errors.Wrapf(err, "yaml.Unmarshal error for %s", path)
+	}
+	return kubeconfig, nil
+}
+
+// DiffKubeconfigFiles compares two kubeconfig files
+func DiffKubeconfigFiles(a, b string) (KubeconfigDiff, error) {
+	kubeconfigA, err := readKubeconfigMap(a)
+	if err != nil {
+		return KubeconfigDiff{}, err
+	}
+	kubeconfigB, err := readKubeconfigMap(b)
+	if err != nil {
+		return KubeconfigDiff{}, err
+	}
+	return DiffKubeconfigs(kubeconfigA, kubeconfigB), nil
+}
+
+// renderDiff renders diff between kubeconfig files a and b for humans
+func renderDiff(a, b string, diff KubeconfigDiff) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s\n%s\n", warning("--- "+a), info("+++ "+b))
+	if diff.Empty() {
+		fmt.Fprintf(&sb, "\n%s\n", t("noDifference"))
+		return sb.String()
+	}
+	if diff.CurrentContext != nil {
+		fmt.Fprintf(&sb, "\ncurrent-context: %s -> %s\n", warning(diff.CurrentContext.Old), info(diff.CurrentContext.New))
+	}
+	section := ""
+	for _, item := range diff.Items {
+		if item.Section != section {
+			section = item.Section
+			fmt.Fprintf(&sb, "\n%s:\n", section)
+		}
+		switch item.Change {
+		case "+":
+			fmt.Fprintf(&sb, "  %s\n", info("+ "+item.Name))
+		case "-":
+			fmt.Fprintf(&sb, "  %s\n", warning("- "+item.Name))
+		default:
+			fmt.Fprintf(&sb, "  ~ %s\n", item.Name)
+		}
+		for _, field := range item.Fields {
+			switch {
+			case !field.OldSet:
+				fmt.Fprintf(&sb, "      %s\n", info("+ "+field.Field+": "+field.New))
+			case !field.NewSet:
+				fmt.Fprintf(&sb, "      %s\n", warning("- "+field.Field+": "+field.Old))
+			default:
+				fmt.Fprintf(&sb, "      %s: %s -> %s\n", field.Field, warning(field.Old), info(field.New))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// runDiff implements "cf diff <kubeconfig> <kubeconfig>"
+func runDiff(args []string) error {
+	candidates, err := loadCandidates()
+	if err != nil {
+		return errors.New(t("unableToRefreshCandidates", err.Error()))
+	}
+	a, err := resolveKubeconfigArg(candidates, args[0])
+	if err != nil {
+		return err
+	}
+	b, err := resolveKubeconfigArg(candidates, args[1])
+	if err != nil {
+		return err
+	}
+	diff, err := DiffKubeconfigFiles(a, b)
+	if err != nil {
+		return err
+	}
+	fmt.Print(renderDiff(a, b, diff))
+	return nil
+}
+
+// markDiffBase marks the selected candidate as the base of the next diff
+func (modal *KubectlCfModal) markDiffBase() tea.Cmd {
+	candidate, ok := modal.list.SelectedItem().(Candidate)
+	if !ok {
+		return nil
+	}
+	if isExecPath(candidate.FullPath) {
+		return modal.list.NewStatusMessage(warning(t("providedOnDemand", candidate.DisplayName(), candidate.Source)))
+	}
+	modal.diffBase = candidate
+	return modal.list.NewStatusMessage(text(t("markedForDiff", info(candidate.DisplayName()))))
+}
+
+// showDiff compares the marked candidate with the selected one, and enters ModeDiff
+func (modal *KubectlCfModal) showDiff() tea.Cmd {
+	candidate, ok := modal.list.SelectedItem().(Candidate)
+	if !ok {
+		return nil
+	}
+	if modal.diffBase.FullPath == "" {
+		return modal.list.NewStatusMessage(warning(t("noKubeconfigMarkedForDiff")))
+	}
+	if isExecPath(candidate.FullPath) {
+		return modal.list.NewStatusMessage(warning(t("providedOnDemand", candidate.DisplayName(), candidate.Source)))
+	}
+	diff, err := DiffKubeconfigFiles(modal.diffBase.FullPath, candidate.FullPath)
+	if err != nil {
+		return modal.list.NewStatusMessage(warning(err.Error()))
+	}
+	h, v := docStyle.GetFrameSize()
+	modal.diffView = viewport.New(modal.width-h, modal.height-v)
+	modal.diffView.SetContent(renderDiff(modal.diffBase.FullPath, candidate.FullPath, diff))
+	modal.mode = ModeDiff
+	return nil
+}
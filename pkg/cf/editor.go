@@ -0,0 +1,58 @@
+package cf
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorFinishedMsg is sent when the editor started by editCandidate exits
+type editorFinishedMsg struct {
+	path string
+	err  error
+}
+
+// editorCommand returns the editor command from $VISUAL or $EDITOR,
+// the value is split by spaces so that flags like "code --wait" are supported
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editCandidate suspends the program and opens the file of candidate in the editor
+func editCandidate(candidate Candidate) tea.Cmd {
+	command := editorCommand()
+	c := exec.Command(command[0], append(command[1:], candidate.FullPath)...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return editorFinishedMsg{path: candidate.FullPath, err: err}
+	})
+}
+
+// validateKubeconfigFile checks if the file is still a valid kubeconfig
+func validateKubeconfigFile(path string) error {
+	_, err := ParseKubeconfigFile(path)
+	return err
+}
+
+// handleEditorFinished validates the edited file and refreshes candidates in place
+func (modal *KubectlCfModal) handleEditorFinished(msg editorFinishedMsg) tea.Cmd {
+	scan := modal.startScan(msg.path)
+
+	if msg.err != nil {
+		return tea.Batch(scan, modal.list.NewStatusMessage(warning(t("editorError", msg.err.Error()))))
+	}
+	if err := validateKubeconfigFile(msg.path); err != nil {
+		return tea.Batch(scan, modal.list.NewStatusMessage(warning(t("invalidKubeconfigAfterEdit", msg.path, err.Error()))))
+	}
+	return tea.Batch(scan, modal.list.NewStatusMessage(text(t("editedKubeconfig", info(msg.path)))))
+}
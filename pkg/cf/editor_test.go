@@ -0,0 +1,59 @@
+package cf
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+func TestEditorCommand(t *testing.T) {
+	fallback := []string{"vi"}
+	if runtime.GOOS == "windows" {
+		fallback = []string{"notepad"}
+	}
+	for _, c := range []struct {
+		visual, editor string
+		want           []string
+	}{
+		{"", "", fallback},
+		{"", "nano", []string{"nano"}},
+		{"code --wait", "nano", []string{"code", "--wait"}},
+		{"  ", "nano", []string{"nano"}}, // blank values are ignored
+	} {
+		t.Setenv("VISUAL", c.visual)
+		t.Setenv("EDITOR", c.editor)
+		if got := editorCommand(); !slices.Equal(got, c.want) {
+			t.Errorf("VISUAL=%q EDITOR=%q: got %v, want %v", c.visual, c.editor, got, c.want)
+		}
+	}
+}
+
+func TestHandleEditorFinishedValidatesKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		name    string
+		content string
+		err     error
+		want    string
+	}{
+		{"valid", "kind: Config\n", nil, "Edited"},
+		{"invalid", "kind: [Config\n", nil, "is not a valid kubeconfig after editing"},
+		{"editor error", "kind: Config\n", errors.New("exit status 1"), "Editor exited with error: exit status 1"},
+	} {
+		path := writeTestFile(t, dir, c.name+".yaml", c.content)
+		modal := &KubectlCfModal{list: list.New(nil, list.NewDefaultDelegate(), 200, 20)}
+		if cmd := modal.handleEditorFinished(editorFinishedMsg{path: path, err: c.err}); cmd == nil {
+			t.Fatalf("%s: expect candidates rescanned", c.name)
+		}
+		if modal.focusPath != path {
+			t.Errorf("%s: focus %q after editing, want %s", c.name, modal.focusPath, path)
+		}
+		if view := modal.list.View(); !strings.Contains(view, c.want) {
+			t.Errorf("%s: status %q not shown in\n%s", c.name, c.want, view)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+package cf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/junchaw/kubectl-cf/pkg/crypt"
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+const encryptArgs = "[--passphrase] <kubeconfig>"
+
+// isEncryptedPath returns true if path is an encrypted kubeconfig, by its suffix
+func isEncryptedPath(path string) bool {
+	return strings.HasSuffix(path, EncryptedFileSuffix)
+}
+
+// runtimeDir returns the private directory for decrypted kubeconfig files,
+// $XDG_RUNTIME_DIR is preferred since it is usually a tmpfs which is cleared on logout
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "kubectl-cf")
+	}
+	return filepath.Join(os.TempDir(), "kubectl-cf-"+strconv.Itoa(os.Getuid()))
+}
+
+// ensureRuntimeDir creates the runtime dir, and refuses to use it if it is accessible by others
+func ensureRuntimeDir() (string, error) {
+	dir := runtimeDir()
+	if err := os.MkdirAll(dir, ConfigDirMode); err != nil {
+		return "", errors.Wrap(err, "create runtime dir error")
+	}
+	if findings := auditFile(dir, nil); len(findings) > 0 {
+		return "", errors.New(t("insecureRuntimeDir", dir, strings.Join(findings.Issues(), ", ")))
+	}
+	return dir, nil
+}
+
+// loadIdentity reads the key file, returns nil if the key file not exist
+func loadIdentity() (*crypt.X25519Identity, error) {
+	f, err := os.ReadFile(keyFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read key file error")
+	}
+	identity, err := crypt.ParseX25519Identity(string(f))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid key file %s", keyFilePath)
+	}
+	return identity, nil
+}
+
+// needsPassphrase returns true if the encrypted file at path can not be decrypted without a passphrase,
+// a passphrase given by environment variable KUBECTL_CF_PASSPHRASE counts as given
+func needsPassphrase(path string) (bool, error) {
+	if os.Getenv("KUBECTL_CF_PASSPHRASE") != "" {
+		return false, nil
+	}
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return false, errors.Wrap(err, "os.ReadFile error")
+	}
+	if crypt.NeedsPassphrase(f) {
+		return true, nil
+	}
+	identity, err := loadIdentity()
+	if err != nil {
+		return false, err
+	}
+	return identity == nil, nil
+}
+
+// decryptKubeconfigFile decrypts the file at path with the key file and passphrase,
+// passphrase falls back to environment variable KUBECTL_CF_PASSPHRASE
+func decryptKubeconfigFile(path, passphrase string) ([]byte, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	var identities []crypt.Identity
+	identity, err := loadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		identities = append(identities, identity)
+	}
+	if passphrase == "" {
+		passphrase = os.Getenv("KUBECTL_CF_PASSPHRASE")
+	}
+	if passphrase != "" {
+		identities = append(identities, crypt.Passphrase(passphrase))
+	}
+	plaintext, err := crypt.Decrypt(f, identities...)
+	if errors.Is(err, crypt.ErrNoIdentityMatched) {
+		return nil, errors.New(t("unableToDecrypt", path))
+	}
+	return plaintext, err
+}
+
+// readDecryptedIndex reads the index of decrypted files, which maps runtime files to their encrypted sources
+func readDecryptedIndex() (map[string]string, error) {
+	index := map[string]string{}
+	f, err := os.ReadFile(decryptedIndexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if err := json.Unmarshal(f, &index); err != nil {
+		return nil, errors.Wrap(err, "corrupted index of decrypted files")
+	}
+	return index, nil
+}
+
+func writeDecryptedIndex(index map[string]string) error {
+	f, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+	return errors.Wrap(os.WriteFile(decryptedIndexPath, f, ConfigFileMode), "os.WriteFile error")
+}
+
+// decryptToRuntimeFile decrypts the encrypted kubeconfig at path into a new file in the runtime dir,
+// returns the path of the runtime file
+func decryptToRuntimeFile(path, passphrase string) (string, error) {
+	plaintext, err := decryptKubeconfigFile(path, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return writeRuntimeFile(path, plaintext)
+}
+
+// writeRuntimeFile writes plaintext decrypted from path into a new file in the runtime dir,
+// returns the path of the runtime file
+func writeRuntimeFile(path string, plaintext []byte) (string, error) {
+	dir, err := ensureRuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	index, err := readDecryptedIndex()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(path))
+	name := strings.TrimSuffix(filepath.Base(path), EncryptedFileSuffix)
+	f, err := os.CreateTemp(dir, hex.EncodeToString(sum[:4])+"-*-"+name) // created with mode 0600
+	if err != nil {
+		return "", errors.Wrap(err, "os.CreateTemp error")
+	}
+	if _, err := f.Write(plaintext); err != nil {
+		_ = f.Close()
+		_ = sys.WipeFile(f.Name())
+		return "", errors.Wrap(err, "write runtime file error")
+	}
+	if err := f.Close(); err != nil {
+		_ = sys.WipeFile(f.Name())
+		return "", errors.Wrap(err, "close runtime file error")
+	}
+
+	index[f.Name()] = path
+	if err := writeDecryptedIndex(index); err != nil {
+		_ = sys.WipeFile(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// sourceOfRuntimeFile returns the encrypted kubeconfig which the runtime file at path is decrypted from,
+// if path is not a runtime file, path itself is returned
+func sourceOfRuntimeFile(path string) string {
+	index, err := readDecryptedIndex()
+	if err != nil {
+		logger.Debugf("Unable to read index of decrypted files: %s", err)
+		return path
+	}
+	if source, ok := index[path]; ok {
+		return source
+	}
+	return path
+}
+
+// wipeRuntimeFile wipes the runtime file at path and removes it from the index,
+// files not in the index are never touched
+func wipeRuntimeFile(path string) error {
+	index, err := readDecryptedIndex()
+	if err != nil {
+		return err
+	}
+	if _, ok := index[path]; !ok {
+		return nil
+	}
+	if err := sys.WipeFile(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(index, path)
+	return writeDecryptedIndex(index)
+}
+
+// wipeReplacedRuntimeFile wipes the runtime file which the kubeconfig symlink pointed to before being replaced,
+// cache files of externally encrypted kubeconfig files are kept until expired,
+// replaced is the raw target of the symlink, target is the new one, failures are only logged
+func wipeReplacedRuntimeFile(replaced, target string) {
+	replaced = resolveSymlinkTarget(replaced)
+	if replaced == "" || isSamePath(replaced, target) {
+		return
+	}
+	if isCacheFile(replaced) && !cacheFileExpired(replaced) { // reused until expired
+		return
+	}
+	if err := wipeRuntimeFile(replaced); err != nil {
+		logger.Warnf("Unable to wipe decrypted kubeconfig %s: %s", replaced, err)
+	}
+}
+
+// runtimeTargetOf returns the file which the kubeconfig symlink points to for the kubeconfig at path:
+// an encrypted kubeconfig is decrypted into a runtime file, an externally encrypted one into a cache file,
+// and a kubeconfig provided on demand by an exec source is fetched into a runtime file, other paths are returned as is
+func runtimeTargetOf(path, passphrase string) (string, error) {
+	var target string
+	var err error
+	switch {
+	case isExecPath(path):
+		if target, err = fetchToRuntimeFile(path); err != nil {
+			return "", errors.New(t("fetchKubeconfigError", err.Error()))
+		}
+		return target, nil
+	case isEncryptedPath(path):
+		target, err = decryptToRuntimeFile(path, passphrase)
+	case isExternallyEncryptedPath(path):
+		target, err = decryptToCacheFile(path)
+	default:
+		return path, nil
+	}
+	if err != nil {
+		return "", errors.New(t("decryptKubeconfigError", err.Error()))
+	}
+	return target, nil
+}
+
+// passphraseInput creates the input for passphrases, the input is not echoed
+func passphraseInput(prompt string) textinput.Model {
+	input := textinput.New()
+	input.Prompt = prompt
+	input.EchoMode = textinput.EchoPassword
+	input.EchoCharacter = '•'
+	input.Focus()
+	return input
+}
+
+// passphrasePrompt is a minimal program which reads a passphrase, used by commands
+type passphrasePrompt struct {
+	input    textinput.Model
+	canceled bool
+}
+
+func (p *passphrasePrompt) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (p *passphrasePrompt) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			return p, tea.Quit
+		case "ctrl+c", "esc":
+			p.canceled = true
+			return p, tea.Quit
+		}
+	}
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return p, cmd
+}
+
+func (p *passphrasePrompt) View() string {
+	return p.input.View() + "\n"
+}
+
+// readPassphrase reads a passphrase from environment variable KUBECTL_CF_PASSPHRASE, or prompts for it
+func readPassphrase(prompt string) (string, error) {
+	if passphrase := os.Getenv("KUBECTL_CF_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	p := &passphrasePrompt{input: passphraseInput(prompt)}
+	if _, err := tea.NewProgram(p).Run(); err != nil {
+		return "", errors.Wrap(err, "read passphrase error")
+	}
+	if p.canceled || p.input.Value() == "" {
+		return "", errors.New(t("passphraseCanceled"))
+	}
+	return p.input.Value(), nil
+}
+
+// runKeygen implements "cf keygen", which generates the key file for encrypting kubeconfig files
+func runKeygen(_ []string) error {
+	if _, err := os.Lstat(keyFilePath); err == nil {
+		return errors.New(t("keyFileAlreadyExists", keyFilePath))
+	}
+	identity, err := crypt.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(keyFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, ConfigFileMode)
+	if err != nil {
+		return errors.Wrap(err, "create key file error")
+	}
+	if _, err := fmt.Fprintln(f, identity.String()); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "write key file error")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close key file error")
+	}
+	fmt.Println(text(t("generatedKeyFile", info(keyFilePath), identity.Recipient().String())))
+	return nil
+}
+
+// replaceWithEncryptionCounterpart writes content to dst, wipes src, and updates the previous file if it points to src.
+// Only the update of the previous file is recorded in the journal: the journal would have to keep the plaintext to undo the rest.
+func replaceWithEncryptionCounterpart(src, dst string, content []byte) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, ConfigFileMode)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile error")
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		_ = os.Remove(dst)
+		return errors.Wrap(err, "write file error")
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(dst)
+		return errors.Wrap(err, "close file error")
+	}
+	if err := sys.WipeFile(src); err != nil {
+		return err
+	}
+
+	previous, err := readPreviousKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	if isSamePath(previous, src) {
+		o := beginOperation(t("updatePreviousDescription", src, dst))
+		defer o.Commit()
+		if err := o.WriteFile(previousKubeconfigConfigPath, &dst, ConfigFileMode); err != nil {
+			return errors.New(t("updatePreviousKubeconfigError", err.Error()))
+		}
+	}
+	return nil
+}
+
+// resolveConvertibleKubeconfigArg resolves arg for "cf encrypt" and "cf decrypt", the current kubeconfig is refused
+func resolveConvertibleKubeconfigArg(arg string) (string, error) {
+	candidates, err := loadCandidates()
+	if err != nil {
+		return "", err
+	}
+	path, err := resolveKubeconfigArg(candidates, arg)
+	if err != nil {
+		return "", err
+	}
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return "", err
+	}
+	if isSamePath(path, currentKubeconfigPath) {
+		return "", errors.New(t("refuseToModifyCurrentKubeconfig"))
+	}
+	return path, nil
+}
+
+// runEncrypt implements "cf encrypt", which encrypts a kubeconfig file for the key file, or with a passphrase,
+// the plaintext file is wiped
+func runEncrypt(args []string) error {
+	flags := flag.NewFlagSet("cf encrypt", flag.ContinueOnError)
+	usePassphrase := flags.Bool("passphrase", false, "encrypt with a passphrase instead of the key file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(t("commandUsage", "encrypt", encryptArgs))
+	}
+	path, err := resolveConvertibleKubeconfigArg(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if isEncryptedPath(path) {
+		return errors.New(t("kubeconfigAlreadyEncrypted", path))
+	}
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "os.ReadFile error")
+	}
+	if crypt.IsEncrypted(plaintext) {
+		return errors.New(t("kubeconfigAlreadyEncrypted", path))
+	}
+
+	var recipient crypt.Recipient
+	if *usePassphrase {
+		passphrase, err := readPassphrase(t("newPassphrasePrompt"))
+		if err != nil {
+			return err
+		}
+		if os.Getenv("KUBECTL_CF_PASSPHRASE") == "" {
+			confirmation, err := readPassphrase(t("confirmPassphrasePrompt"))
+			if err != nil {
+				return err
+			}
+			if confirmation != passphrase {
+				return errors.New(t("passphrasesNotMatch"))
+			}
+		}
+		recipient = crypt.Passphrase(passphrase)
+	} else {
+		identity, err := loadIdentity()
+		if err != nil {
+			return err
+		}
+		if identity == nil {
+			return errors.New(t("noKeyFile", keyFilePath))
+		}
+		recipient = identity.Recipient()
+	}
+
+	ciphertext, err := crypt.Encrypt(plaintext, recipient)
+	if err != nil {
+		return err
+	}
+	if err := replaceWithEncryptionCounterpart(path, path+EncryptedFileSuffix, ciphertext); err != nil {
+		return err
+	}
+	fmt.Println(text(t("encryptedKubeconfig", info(path), info(path+EncryptedFileSuffix))))
+	return nil
+}
+
+// runDecrypt implements "cf decrypt", which turns an encrypted kubeconfig file back into plaintext
+func runDecrypt(args []string) error {
+	path, err := resolveConvertibleKubeconfigArg(args[0])
+	if err != nil {
+		return err
+	}
+	if !isEncryptedPath(path) {
+		return errors.New(t("kubeconfigNotEncrypted", path))
+	}
+	var passphrase string
+	if ok, err := needsPassphrase(path); err != nil {
+		return err
+	} else if ok {
+		if passphrase, err = readPassphrase(t("passphrasePrompt")); err != nil {
+			return err
+		}
+	}
+	plaintext, err := decryptKubeconfigFile(path, passphrase)
+	if err != nil {
+		return err
+	}
+	dst := strings.TrimSuffix(path, EncryptedFileSuffix)
+	if err := replaceWithEncryptionCounterpart(path, dst, plaintext); err != nil {
+		return err
+	}
+	fmt.Println(text(t("decryptedKubeconfig", info(path), info(dst))))
+	return nil
+}
+
+// switchTo switches to the kubeconfig at path, asking for the passphrase first if it is needed to decrypt it
+func (modal *KubectlCfModal) switchTo(path string) tea.Cmd {
+	if isEncryptedPath(path) && modal.passphrase == "" {
+		ok, err := needsPassphrase(path)
+		if err != nil {
+			return modal.quit(warning(t("decryptKubeconfigError", err.Error())))
+		}
+		if ok {
+			modal.switchTarget = path
+			modal.passphraseInput = passphraseInput(t("passphrasePrompt"))
+			modal.mode = ModePassphrase
+			return textinput.Blink
+		}
+	}
+	return modal.startSwitch(path)
+}
+
+// runtimeTargetMsg is sent when the runtime target of the kubeconfig at path is ready, see startSwitch
+type runtimeTargetMsg struct {
+	path   string
+	target string
+	err    error
+}
+
+// startSwitch enters ModeSwitching, and prepares the runtime target of the kubeconfig at path in the background,
+// since decrypting or fetching it may take long, the symlink is created once runtimeTargetMsg is received,
+// an externally encrypted kubeconfig is decrypted in the terminal instead if decryptInteractive is true
+func (modal *KubectlCfModal) startSwitch(path string) tea.Cmd {
+	modal.mode = ModeSwitching
+	modal.switchTarget = path
+	if decryptInteractive && !isExecPath(path) && !isEncryptedPath(path) && isExternallyEncryptedPath(path) {
+		return decryptInTerminal(path)
+	}
+	passphrase := modal.passphrase
+	return func() tea.Msg {
+		target, err := runtimeTargetOf(path, passphrase)
+		return runtimeTargetMsg{path: path, target: target, err: err}
+	}
+}
+
+// finishSwitch points the kubeconfig symlink to the runtime target in msg, and quits
+func (modal *KubectlCfModal) finishSwitch(msg runtimeTargetMsg) tea.Cmd {
+	if msg.err != nil {
+		return modal.quit(warning(msg.err.Error()))
+	}
+	return modal.quit(modal.symlinkConfigPathToTarget(msg.path, msg.target))
+}
+
+func (modal *KubectlCfModal) updatePassphrase(msg tea.Msg) tea.Cmd {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			modal.passphrase = modal.passphraseInput.Value()
+			if modal.passphrase == "" {
+				return nil
+			}
+			return modal.startSwitch(modal.switchTarget)
+		case "esc":
+			return modal.backToSelect("")
+		}
+	}
+	var cmd tea.Cmd
+	modal.passphraseInput, cmd = modal.passphraseInput.Update(msg)
+	return cmd
+}
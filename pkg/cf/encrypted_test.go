@@ -0,0 +1,80 @@
+package cf
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestRuntimeFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := writeEncryptedTestFile(t, dir, "a.yaml"+EncryptedFileSuffix, "a")
+	plain := writeTestFile(t, dir, "b.yaml", "b")
+
+	runtimeFile, err := decryptToRuntimeFile(source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(runtimeFile); err != nil || string(content) != "a" {
+		t.Fatalf("unexpected runtime file content %q, %v", content, err)
+	}
+	if stat, err := os.Stat(runtimeFile); err != nil || (runtime.GOOS != "windows" && stat.Mode().Perm() != 0600) {
+		t.Errorf("runtime file is not private: %v, %v", stat.Mode(), err)
+	}
+	if got := sourceOfRuntimeFile(runtimeFile); got != source {
+		t.Errorf("source of runtime file is %s, want %s", got, source)
+	}
+
+	wipeReplacedRuntimeFile(plain, runtimeFile) // not a runtime file, never touched
+	if _, err := os.Stat(plain); err != nil {
+		t.Errorf("file not in the index is wiped: %s", err)
+	}
+	wipeReplacedRuntimeFile(runtimeFile, runtimeFile) // still in use
+	if _, err := os.Stat(runtimeFile); err != nil {
+		t.Errorf("runtime file in use is wiped: %s", err)
+	}
+	wipeReplacedRuntimeFile(runtimeFile, plain)
+	if _, err := os.Stat(runtimeFile); !os.IsNotExist(err) {
+		t.Errorf("replaced runtime file is not wiped")
+	}
+	if got := sourceOfRuntimeFile(runtimeFile); got != runtimeFile {
+		t.Errorf("wiped runtime file is still in the index")
+	}
+}
+
+func TestReplaceWithEncryptionCounterpart(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestFile(t, dir, "a.yaml", "a")
+	dst := src + EncryptedFileSuffix
+	if err := os.WriteFile(previousKubeconfigConfigPath, []byte(src), ConfigFileMode); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(previousKubeconfigConfigPath) })
+	_ = os.Remove(journalPath)
+
+	if err := replaceWithEncryptionCounterpart(src, dst, []byte("encrypted")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("source is not wiped")
+	}
+	if content, err := os.ReadFile(dst); err != nil || string(content) != "encrypted" {
+		t.Errorf("unexpected counterpart content %q, %v", content, err)
+	}
+	if previous, _ := readPreviousKubeconfigPath(); previous != dst {
+		t.Errorf("previous is %s, want %s", previous, dst)
+	}
+	if step := lastEntry(t).Steps[0]; step.Action != StepWrite || step.Path != previousKubeconfigConfigPath {
+		t.Errorf("update of the previous file is not journaled: %+v", step)
+	}
+
+	if err := replaceWithEncryptionCounterpart(dst, src, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceWithEncryptionCounterpart(src, src+".other", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceWithEncryptionCounterpart(writeTestFile(t, dir, "c.yaml", "c"), src+".other", nil); err == nil {
+		t.Error("expect an error, the counterpart already exists")
+	}
+}
@@ -0,0 +1,192 @@
+package cf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The exec protocol lets an external command provide kubeconfigs, like kubeconfigs generated from an inventory,
+// the command of an exec source, see Source.Exec, is run with extra arguments:
+//
+//	<command> list          prints execListResponse as JSON to stdout
+//	<command> get <name>    prints the kubeconfig content of name to stdout, for kubeconfigs listed without a path
+//
+// A non-zero exit status is an error, stderr is shown with it.
+
+// execListResponse is the output of "<command> list"
+type execListResponse struct {
+	Kubeconfigs []execKubeconfig `json:"kubeconfigs"`
+}
+
+// execKubeconfig is a kubeconfig listed by an exec source
+type execKubeconfig struct {
+	// Name is the name of the kubeconfig, which may contain "/", unique in the source
+	Name string `json:"name"`
+
+	// Description is shown in the list instead of the path, optional
+	Description string `json:"description,omitempty"`
+
+	// Path is the absolute path of the kubeconfig file,
+	// if empty, the content is printed by "<command> get <name>" when switching to it
+	Path string `json:"path,omitempty"`
+}
+
+// ExecPathPrefix is the prefix of the full paths of kubeconfigs provided on demand by exec sources,
+// like "exec://inventory-1a2b3c4d/prod", which are not files, see execPath
+const ExecPathPrefix = "exec://"
+
+// isExecPath returns true if path is provided on demand by an exec source
+func isExecPath(path string) bool {
+	return strings.HasPrefix(path, ExecPathPrefix)
+}
+
+// execName returns the base name of the command of the exec source, like "inventory" for "/opt/bin/inventory --team a"
+func (s Source) execName() string {
+	args := strings.Fields(s.Exec)
+	if len(args) == 0 {
+		return ""
+	}
+	return filepath.Base(args[0])
+}
+
+// execID identifies the exec source by the base name of its command and a hash of the whole command line,
+// like "inventory-1a2b3c4d", so sources running the same command with different arguments are told apart
+func (s Source) execID() string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(s.Exec), " ")))
+	return s.execName() + "-" + hex.EncodeToString(sum[:4])
+}
+
+// execPath returns the full path of the kubeconfig name provided on demand by the exec source
+func (s Source) execPath(name string) string {
+	return ExecPathPrefix + s.execID() + "/" + name
+}
+
+// parseExecPath returns the exec source and the name of the kubeconfig provided on demand at path
+func parseExecPath(path string) (Source, string, error) {
+	execID, name, ok := strings.Cut(strings.TrimPrefix(path, ExecPathPrefix), "/")
+	if !isExecPath(path) || !ok {
+		return Source{}, "", errors.New(t("noExecSource", path))
+	}
+	for _, source := range kubeconfigSources {
+		if source.Exec != "" && source.execID() == execID {
+			return source, name, nil
+		}
+	}
+	return Source{}, "", errors.New(t("noExecSource", path))
+}
+
+// runExec runs the command of the exec source with args, returns the output printed to stdout
+func (s Source) runExec(args ...string) ([]byte, error) {
+	args = append(strings.Fields(s.Exec), args...)
+	ctx, cancel := context.WithTimeout(context.Background(), ExecCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New(t("execCommandTimeout", strings.Join(args, " "), ExecCommandTimeout))
+		}
+		return nil, errors.New(t("execCommandError", strings.Join(args, " "), err.Error(), strings.TrimSpace(stderr.String())))
+	}
+	return stdout.Bytes(), nil
+}
+
+// ListKubeconfigCandidatesInExecSource lists the kubeconfigs provided by the exec source,
+// kubeconfigs with paths are parsed like kubeconfig files found in directories,
+// others have full paths like "exec://inventory-1a2b3c4d/prod", see execPath, and are described by the source only
+func ListKubeconfigCandidatesInExecSource(source Source) ([]Candidate, error) {
+	output, err := source.runExec("list")
+	if err != nil {
+		return nil, err
+	}
+	var response execListResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, errors.Wrapf(err, "invalid output of %s list", source.Exec)
+	}
+
+	var candidates []Candidate
+	var names []string
+	for _, kubeconfig := range response.Kubeconfigs {
+		if kubeconfig.Name == "" || slices.Contains(names, kubeconfig.Name) {
+			logger.Debugf("Skip kubeconfig %q of %s: empty or duplicated name", kubeconfig.Name, source.Exec)
+			continue
+		}
+		names = append(names, kubeconfig.Name)
+		candidate := Candidate{
+			Name:     source.Prefix + kubeconfig.Name,
+			Summary:  kubeconfig.Description,
+			FullPath: source.execPath(kubeconfig.Name),
+		}
+		if kubeconfig.Path != "" {
+			if !filepath.IsAbs(kubeconfig.Path) {
+				logger.Debugf("Skip kubeconfig %s of %s: path %s is not absolute", kubeconfig.Name, source.Exec, kubeconfig.Path)
+				continue
+			}
+			stat, err := os.Stat(kubeconfig.Path)
+			if err != nil {
+				logger.Debugf("Skip kubeconfig %s of %s: %s", kubeconfig.Name, source.Exec, err)
+				continue
+			}
+			candidate.FullPath = kubeconfig.Path
+			candidate.Encrypted = isEncryptedPath(kubeconfig.Path) || isExternallyEncryptedPath(kubeconfig.Path)
+			indexed := indexCandidate(candidate)
+			candidate.Provider, candidate.CurrentContext = indexed.Provider, indexed.CurrentContext
+			candidate.Contexts, candidate.Servers = indexed.Contexts, indexed.Servers
+			candidate.ModTime = stat.ModTime()
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// fetchToRuntimeFile gets the content of the kubeconfig provided on demand at path from its exec source,
+// into a new file in the runtime dir like decrypted kubeconfig files, returns the path of the runtime file
+func fetchToRuntimeFile(path string) (string, error) {
+	source, name, err := parseExecPath(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := source.runExec("get", name)
+	if err != nil {
+		return "", err
+	}
+	return writeRuntimeFile(path, content)
+}
+
+// scanExecSource lists candidates provided by the exec source, see scanSource,
+// the files of kubeconfigs with paths are audited, and their directories are watched
+func scanExecSource(source Source, currentKubeconfigPath string) sourceScan {
+	var scan sourceScan
+	candidates, err := ListKubeconfigCandidatesInExecSource(source)
+	if err != nil {
+		scan.sourceErrors = append(scan.sourceErrors, SourceError{Source: source.label(), Err: err})
+		return scan
+	}
+	for _, candidate := range candidates {
+		if !isExecPath(candidate.FullPath) {
+			scan.dirs = append(scan.dirs, filepath.Dir(candidate.FullPath))
+		}
+	}
+	trustedDirs := trustedDirs(currentKubeconfigPath, scan.dirs...) // files listed by the source are trusted like scanned directories
+	for _, candidate := range candidates {
+		if !isExecPath(candidate.FullPath) {
+			candidate.Warnings = auditFile(candidate.FullPath, trustedDirs).Issues()
+		}
+		candidate.Source, candidate.Origin = source.execName(), source
+		candidate.Tags = config.TagsOf(candidate.Name)
+		scan.candidates = append(scan.candidates, candidate)
+	}
+	return scan
+}
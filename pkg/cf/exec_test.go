@@ -0,0 +1,95 @@
+package cf
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExecPath(t *testing.T) {
+	a := Source{Exec: "/opt/bin/inventory --team a"}
+	b := Source{Exec: "inventory  --team b"}
+	defer func(sources []Source) { kubeconfigSources = sources }(kubeconfigSources)
+	kubeconfigSources = []Source{{Path: "/kube"}, a, b}
+
+	pathA, pathB := a.execPath("team/prod"), b.execPath("team/prod")
+	if pathA == pathB {
+		t.Fatalf("sources with different arguments have the same path %s", pathA)
+	}
+	if !isExecPath(pathA) || !strings.HasPrefix(pathA, ExecPathPrefix+"inventory-") {
+		t.Errorf("unexpected exec path %s", pathA)
+	}
+	if (Source{Exec: " /opt/bin/inventory  --team a "}).execPath("team/prod") != pathA {
+		t.Error("exec path changes with whitespace in the command")
+	}
+
+	for path, want := range map[string]Source{pathA: a, pathB: b} {
+		source, name, err := parseExecPath(path)
+		if err != nil {
+			t.Errorf("parse %s: %s", path, err)
+			continue
+		}
+		if source.Exec != want.Exec || name != "team/prod" {
+			t.Errorf("parse %s: got %s, %s, want %s, team/prod", path, source.Exec, name, want.Exec)
+		}
+	}
+	for _, path := range []string{ExecPathPrefix + "inventory/prod", ExecPathPrefix + a.execID(), "/kube/prod.yaml"} {
+		if _, _, err := parseExecPath(path); err == nil {
+			t.Errorf("parse %s: expect an error", path)
+		}
+	}
+}
+
+func TestListKubeconfigCandidatesInExecSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is a shell script")
+	}
+	dir := t.TempDir()
+	shared := writeTestFile(t, dir, "shared.yaml", "")
+	script := writeTestFile(t, dir, "inventory", `#!/bin/sh
+case "$3 $4" in
+"list ") echo '{"kubeconfigs": [
+  {"name": "shared", "path": "`+shared+`"},
+  {"name": "staging", "description": "Staging"},
+  {"name": "staging"},
+  {"name": "relative", "path": "relative.yaml"}
+]}' ;;
+"get staging") echo "kind: Config" ;;
+*) echo "unknown $*" >&2; exit 1 ;;
+esac
+`)
+	if err := os.Chmod(script, 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := Source{Exec: script + " --team a", Prefix: "inv/"}
+	defer func(sources []Source) { kubeconfigSources = sources }(kubeconfigSources)
+	kubeconfigSources = []Source{source}
+
+	candidates, err := ListKubeconfigCandidatesInExecSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2: %+v", len(candidates), candidates)
+	}
+	if candidates[0].Name != "inv/shared" || candidates[0].FullPath != shared {
+		t.Errorf("unexpected candidate %+v", candidates[0])
+	}
+	if candidates[1].Name != "inv/staging" || candidates[1].FullPath != source.execPath("staging") || candidates[1].Summary != "Staging" {
+		t.Errorf("unexpected candidate %+v", candidates[1])
+	}
+
+	runtimeFile, err := fetchToRuntimeFile(candidates[1].FullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = wipeRuntimeFile(runtimeFile) }()
+	if content, _ := os.ReadFile(runtimeFile); string(content) != "kind: Config\n" {
+		t.Errorf("unexpected fetched content %q", content)
+	}
+
+	if _, err := fetchToRuntimeFile(source.execPath("missing")); err == nil || !strings.Contains(err.Error(), "get missing") {
+		t.Errorf("got %v, want an error with stderr of the command", err)
+	}
+}
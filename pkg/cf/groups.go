@@ -0,0 +1,145 @@
+package cf
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Group-by modes of the list, cycled by "tab"
+const (
+	GroupBySource = iota
+	GroupByTag
+	GroupByProvider
+)
+
+// groupByNames are the names of group-by modes, indexed by the modes
+var groupByNames = []string{"source", "tag", "provider"}
+
+// tabsHeight is the height of the group tabs above the list
+const tabsHeight = 1
+
+// headerHeight returns the height above the list, the banner of source errors and the group tabs
+func (modal *KubectlCfModal) headerHeight() int {
+	if len(modal.sourceErrors) > 0 {
+		return tabsHeight + 1
+	}
+	return tabsHeight
+}
+
+var (
+	bannerStyle    = lipgloss.NewStyle().PaddingLeft(2)
+	tabsStyle      = lipgloss.NewStyle().PaddingLeft(2)
+	tabStyle       = lipgloss.NewStyle().Padding(0, 1).Foreground(lipgloss.Color("245"))
+	activeTabStyle = lipgloss.NewStyle().Padding(0, 1).Foreground(lipgloss.Color("28")).Bold(true).Underline(true)
+)
+
+// Group is a named subset of candidates, shown as a tab above the list
+type Group struct {
+	Name       string
+	Candidates Candidates
+}
+
+// displayPath shortens path for display by replacing the home dir with "~"
+func displayPath(path string) string {
+	if rel, err := filepath.Rel(homeDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+// GroupBy groups candidates by the mode, the first group always contains all candidates.
+// Groups by source are in the order of kubeconfigSources, other groups are sorted by name,
+// candidates without tags or provider are grouped last.
+func (c Candidates) GroupBy(mode int) []Group {
+	groups := []Group{{Name: t("allGroup"), Candidates: c}}
+	var names []string
+	members := map[string]Candidates{}
+	add := func(name string, candidate Candidate) {
+		if _, ok := members[name]; !ok {
+			names = append(names, name)
+		}
+		members[name] = append(members[name], candidate)
+	}
+
+	var ungrouped Candidates
+	for _, candidate := range c {
+		switch mode {
+		case GroupBySource:
+			add(displayPath(candidate.Source), candidate)
+		case GroupByTag:
+			for _, tag := range candidate.Tags {
+				add(tag, candidate)
+			}
+			if len(candidate.Tags) == 0 {
+				ungrouped = append(ungrouped, candidate)
+			}
+		case GroupByProvider:
+			if candidate.Provider != "" {
+				add(candidate.Provider, candidate)
+			} else {
+				ungrouped = append(ungrouped, candidate)
+			}
+		}
+	}
+	if mode != GroupBySource {
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		groups = append(groups, Group{Name: name, Candidates: members[name]})
+	}
+	if len(ungrouped) > 0 {
+		groups = append(groups, Group{Name: t("ungroupedGroup", groupByNames[mode]), Candidates: ungrouped})
+	}
+	return groups
+}
+
+// applyGroup shows the candidates of the selected group in the list,
+// the group is kept by name across refreshes, falls back to the first group if it is gone
+func (modal *KubectlCfModal) applyGroup() {
+	groups := modal.candidates.GroupBy(modal.groupBy)
+	modal.groupIndex = 0
+	for i, group := range groups[1:] { // the first group is selected by an empty name, it may clash with a tag
+		if group.Name == modal.groupName {
+			modal.groupIndex = i + 1
+		}
+	}
+	modal.list.SetItems(groups[modal.groupIndex].Candidates.ToListItems())
+}
+
+// switchGroup selects the group at offset from the selected group, wrapping around
+func (modal *KubectlCfModal) switchGroup(offset int) {
+	groups := modal.candidates.GroupBy(modal.groupBy)
+	index := (modal.groupIndex + offset + len(groups)) % len(groups)
+	modal.groupName = ""
+	if index > 0 {
+		modal.groupName = groups[index].Name
+	}
+	modal.applyGroup()
+	modal.list.ResetSelected()
+}
+
+// cycleGroupBy switches to the next group-by mode, starting from the group with all candidates
+func (modal *KubectlCfModal) cycleGroupBy() {
+	modal.groupBy = (modal.groupBy + 1) % len(groupByNames)
+	modal.groupName = ""
+	modal.applyGroup()
+}
+
+// viewTabs renders the groups as tabs, with the number of candidates in each group
+func (modal *KubectlCfModal) viewTabs() string {
+	tabs := []string{t("groupBy", groupByNames[modal.groupBy])}
+	for i, group := range modal.candidates.GroupBy(modal.groupBy) {
+		tab := fmt.Sprintf("%s (%d)", group.Name, len(group.Candidates))
+		if i == modal.groupIndex {
+			tabs = append(tabs, activeTabStyle.Render(tab))
+		} else {
+			tabs = append(tabs, tabStyle.Render(tab))
+		}
+	}
+	tabs = append(tabs, tabStyle.Render(t("sortBy", modal.sortMode)))
+	return tabsStyle.MaxWidth(modal.width).Render(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
+}
@@ -0,0 +1,159 @@
+package cf
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+var groupTestCandidates = Candidates{
+	{Name: "prod-eu", FullPath: "/work/prod-eu.yaml", Source: "/work", Tags: []string{"eu", "production"}, Provider: ProviderEKS},
+	{Name: "prod-us", FullPath: "/clients/prod-us.yaml", Source: "/clients", Tags: []string{"production"}, Provider: ProviderGKE},
+	{Name: "dev", FullPath: "/work/dev.yaml", Source: "/work", Provider: ProviderLocal},
+	{Name: "broken", FullPath: "/work/broken.yaml", Source: "/work"},
+}
+
+// groupSummary describes groups like "All:a,b /work:a"
+func groupSummary(groups []Group) string {
+	var summary []string
+	for _, group := range groups {
+		summary = append(summary, group.Name+":"+strings.Join(candidateNames(group.Candidates), ","))
+	}
+	return strings.Join(summary, " ")
+}
+
+func TestGroupBy(t *testing.T) {
+	all := "All:broken,dev,prod-eu,prod-us"
+	for _, c := range []struct {
+		mode int
+		want []string
+	}{
+		{GroupBySource, []string{all, "/work:broken,dev,prod-eu", "/clients:prod-us"}}, // in the order of sources
+		{GroupByTag, []string{all, "eu:prod-eu", "production:prod-eu,prod-us", "no tag:broken,dev"}},
+		{GroupByProvider, []string{all, "eks:prod-eu", "gke:prod-us", "local:dev", "no provider:broken"}},
+	} {
+		if got := groupSummary(groupTestCandidates.GroupBy(c.mode)); got != strings.Join(c.want, " ") {
+			t.Errorf("group by %s: got %s, want %s", groupByNames[c.mode], got, strings.Join(c.want, " "))
+		}
+	}
+	if groups := Candidates(nil).GroupBy(GroupByTag); len(groups) != 1 || len(groups[0].Candidates) != 0 {
+		t.Errorf("got groups %+v of no candidates, want only the empty group of all candidates", groups)
+	}
+}
+
+func TestSwitchGroup(t *testing.T) {
+	modal := &KubectlCfModal{
+		list:       list.New(nil, list.NewDefaultDelegate(), 0, 0),
+		candidates: groupTestCandidates,
+		groupBy:    GroupByTag,
+		width:      200,
+	}
+	modal.applyGroup()
+	for _, c := range []struct {
+		offset int
+		want   string
+		count  int
+	}{
+		{1, "eu", 1},
+		{1, "production", 2},
+		{2, "", 4}, // wraps around to all candidates, past the ungrouped candidates
+		{-1, "no tag", 2},
+	} {
+		modal.switchGroup(c.offset)
+		if modal.groupName != c.want || len(modal.list.Items()) != c.count {
+			t.Errorf("switch by %d: got group %q of %d candidates, want %q of %d", c.offset, modal.groupName, len(modal.list.Items()), c.want, c.count)
+		}
+	}
+
+	// the group is kept by name when candidates change, and falls back to all candidates once it is gone
+	modal.switchGroup(-1) // production
+	modal.candidates = groupTestCandidates[1:]
+	modal.applyGroup()
+	if modal.groupName != "production" || len(modal.list.Items()) != 1 {
+		t.Errorf("got group %q of %d candidates after refreshing, want production of 1", modal.groupName, len(modal.list.Items()))
+	}
+	modal.candidates = groupTestCandidates[2:]
+	modal.applyGroup()
+	if modal.groupIndex != 0 || len(modal.list.Items()) != 2 {
+		t.Errorf("got group %d of %d candidates after the group is gone, want all 2 candidates", modal.groupIndex, len(modal.list.Items()))
+	}
+
+	modal.cycleGroupBy()
+	if modal.groupBy != GroupByProvider || modal.groupIndex != 0 {
+		t.Errorf("got group-by mode %d, group %d, want the first group by provider", modal.groupBy, modal.groupIndex)
+	}
+	if view := modal.viewTabs(); !strings.Contains(view, "All (2)") || !strings.Contains(view, "local (1)") {
+		t.Errorf("unexpected counts in tabs %s", view)
+	}
+}
+
+func TestConfigTagsOf(t *testing.T) {
+	config := &Config{Tags: map[string][]string{
+		"prod-*":   {"production", "critical"},
+		"*-eu":     {"eu", "production"},
+		"team/*":   {"team"},
+		"[invalid": {"never"},
+	}}
+	for name, want := range map[string][]string{
+		"prod-eu":  {"critical", "eu", "production"}, // sorted and deduplicated
+		"prod-us":  {"critical", "production"},
+		"team/dev": {"team"},
+		"team/a/b": nil, // "*" does not match "/"
+		"dev":      nil,
+	} {
+		if got := config.TagsOf(name); !slices.Equal(got, want) {
+			t.Errorf("TagsOf(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestKubeconfigProvider(t *testing.T) {
+	for _, c := range []struct {
+		kubeconfig string
+		want       string
+	}{
+		{"clusters:\n- name: a\n  cluster:\n    server: https://abc.gr7.eu-west-1.eks.amazonaws.com\n", ProviderEKS},
+		{"clusters:\n- name: a\n  cluster:\n    server: https://a.hcp.westeurope.azmk8s.io:443\n", ProviderAKS},
+		{"clusters:\n- name: a\n  cluster:\n    server: https://127.0.0.1:6443\n", ProviderLocal},
+		{"clusters:\n- name: a\n  cluster:\n    server: https://10.0.0.1\n", ProviderOther},
+		{"", ProviderOther},
+		{`current-context: a
+contexts:
+- name: a
+  context: {cluster: a, user: a}
+clusters:
+- name: a
+  cluster: {server: "https://34.1.2.3"}
+users:
+- name: a
+  user:
+    exec: {command: /usr/bin/gke-gcloud-auth-plugin}
+`, ProviderGKE},
+		{`current-context: b
+contexts:
+- name: a
+  context: {cluster: a, user: a}
+- name: b
+  context: {cluster: b, user: a}
+clusters:
+- name: a
+  cluster: {server: "https://localhost:6443"}
+- name: b
+  cluster: {server: "https://10.0.0.1"}
+users:
+- name: a
+  user:
+    auth-provider: {name: azure}
+`, ProviderAKS}, // by the current context, not the first cluster
+	} {
+		kubeconfig, err := ParseKubeconfig([]byte(c.kubeconfig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := kubeconfig.Provider(); got != c.want {
+			t.Errorf("got provider %s of\n%s\nwant %s", got, c.kubeconfig, c.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Index caches the kubeconfig files found in directories with their parsed metadata, keyed by directory,
+// it is stored in the kubectl-cf config dir, see ListKubeconfigCandidatesInDir
+type Index map[string]*IndexedDir
+
+// IndexedDir is a directory in the index, valid as long as the directory, the files in it and the source are not changed
+type IndexedDir struct {
+	// ModTime is the modification time of the directory, which changes when files are added, removed or renamed
+	ModTime time.Time `json:"modTime"`
+
+	// Key describes how the directory is scanned, see Source.indexKey
+	Key string `json:"key"`
+
+	// Files are the files matching the pattern of the source, including those not detected as kubeconfig by content
+	Files []IndexedFile `json:"files"`
+}
+
+// IndexedFile is a file in an indexed directory
+type IndexedFile struct {
+	FileName string    `json:"fileName"`
+	ModTime  time.Time `json:"modTime"`
+	Size     int64     `json:"size"`
+
+	// Candidate is the kubeconfig found in the file, nil if it is not a kubeconfig
+	Candidate *IndexedCandidate `json:"candidate,omitempty"`
+}
+
+// IndexedCandidate is the cached part of a Candidate
+type IndexedCandidate struct {
+	Name           string   `json:"name"`
+	Encrypted      bool     `json:"encrypted,omitempty"`
+	Provider       string   `json:"provider,omitempty"`
+	CurrentContext string   `json:"currentContext,omitempty"`
+	Contexts       []string `json:"contexts,omitempty"`
+	Servers        []string `json:"servers,omitempty"`
+}
+
+var (
+	index      Index // loaded on first use, see loadIndex
+	indexOnce  sync.Once
+	indexMutex sync.Mutex // sources are scanned concurrently
+	indexDirty bool
+)
+
+// loadIndex reads the index file once, a missing or corrupted index is rebuilt
+func loadIndex() {
+	indexOnce.Do(func() {
+		index = Index{}
+		f, err := os.ReadFile(indexPath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Debugf("Unable to read index, rebuilding: %s", err)
+			}
+			return
+		}
+		if err := json.Unmarshal(f, &index); err != nil {
+			logger.Debugf("Corrupted index, rebuilding: %s", err)
+			index = Index{}
+		}
+	})
+}
+
+// saveIndex writes the index file if it is changed, failures are only logged since the index is only a cache
+func saveIndex() {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+	if !indexDirty {
+		return
+	}
+	f, err := json.Marshal(index)
+	if err != nil {
+		logger.Debugf("Unable to save index: %s", err)
+		return
+	}
+	tmp, err := os.CreateTemp(kubectlCfConfigDir, ".index-*") // created with mode 0600
+	if err != nil {
+		logger.Debugf("Unable to save index: %s", err)
+		return
+	}
+	_, err = tmp.Write(f)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), indexPath) // other kubectl-cf processes never read a partially written index
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		logger.Debugf("Unable to save index: %s", err)
+		return
+	}
+	indexDirty = false
+}
+
+// indexKey describes how the directory at rel, relative to the source, is scanned,
+// an indexed directory is only valid with the same key
+func (s Source) indexKey(rel string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s", s.matchPattern().String(), decryptFilenameMatchPattern.String(),
+		s.nameGroup(), s.Detect, s.NameTemplate, strings.Join(s.Exclude, "\x01"), rel)
+}
+
+// lookupIndex returns the indexed candidates in dir, if the directory, each file in it, and key are not changed
+func lookupIndex(dir, key string, modTime time.Time) ([]Candidate, bool) {
+	loadIndex()
+	indexMutex.Lock()
+	indexed, ok := index[dir]
+	indexMutex.Unlock()
+	if !ok || indexed.Key != key || !indexed.ModTime.Equal(modTime) {
+		return nil, false
+	}
+
+	var candidates []Candidate
+	for _, file := range indexed.Files {
+		fullPath := filepath.Join(dir, file.FileName)
+		stat, err := os.Stat(fullPath)
+		if err != nil || !stat.ModTime().Equal(file.ModTime) || stat.Size() != file.Size {
+			return nil, false
+		}
+		if file.Candidate != nil {
+			candidates = append(candidates, file.Candidate.toCandidate(fullPath, file.ModTime))
+		}
+	}
+	return candidates, true
+}
+
+// storeIndex replaces the indexed dir, it is saved by saveIndex
+func storeIndex(dir string, indexed *IndexedDir) {
+	loadIndex()
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+	index[dir] = indexed
+	indexDirty = true
+}
+
+// indexCandidate returns the cached part of candidate, with metadata parsed from the file
+func indexCandidate(candidate Candidate) *IndexedCandidate {
+	indexed := &IndexedCandidate{Name: candidate.Name, Encrypted: candidate.Encrypted}
+	kubeconfig, err := ParseKubeconfigFile(candidate.FullPath)
+	if err != nil {
+		return indexed
+	}
+	indexed.Provider = kubeconfig.Provider()
+	indexed.CurrentContext = kubeconfig.CurrentContext
+	for _, c := range kubeconfig.Contexts {
+		indexed.Contexts = append(indexed.Contexts, c.Name)
+	}
+	for _, c := range kubeconfig.Clusters {
+		indexed.Servers = append(indexed.Servers, c.Cluster.Server)
+	}
+	return indexed
+}
+
+// toCandidate returns the candidate of the indexed file at fullPath
+func (c *IndexedCandidate) toCandidate(fullPath string, modTime time.Time) Candidate {
+	return Candidate{
+		Name:           c.Name,
+		FullPath:       fullPath,
+		Encrypted:      c.Encrypted,
+		Provider:       c.Provider,
+		ModTime:        modTime,
+		CurrentContext: c.CurrentContext,
+		Contexts:       c.Contexts,
+		Servers:        c.Servers,
+	}
+}
+
+// indexArgs describes the arguments of "cf index"
+const indexArgs = "rebuild"
+
+// runIndex implements "cf index rebuild", which is only dispatched with a subcommand, like "cf config"
+func runIndex(args []string) error {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return errors.New(t("commandUsage", "index", indexArgs))
+	}
+	if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove index error")
+	}
+	loadIndex() // the index is empty now
+	candidates, err := loadCandidates()
+	if err != nil {
+		return err
+	}
+	fmt.Println(text(t("indexRebuilt", len(candidates), len(index))))
+	return nil
+}
@@ -0,0 +1,123 @@
+package cf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const indexTestKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context:
+    cluster: dev
+`
+
+// touch sets the modification time of path to an hour ago plus offset, so changes are visible to the index
+func touch(t *testing.T, path string, offset time.Duration) {
+	t.Helper()
+	modTime := time.Now().Add(-time.Hour + offset)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexValidity(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "dev.yaml", indexTestKubeconfig)
+	writeTestFile(t, dir, "other.yaml", "not a kubeconfig")
+	touch(t, dir, 0)
+	source := Source{Path: dir, Detect: DetectPattern}
+
+	candidates, err := ListKubeconfigCandidatesInDir(dir, source, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(candidates))
+	}
+	dirModTime := func() time.Time {
+		stat, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stat.ModTime()
+	}
+
+	cached, ok := lookupIndex(dir, source.indexKey(""), dirModTime())
+	if !ok || len(cached) != 2 {
+		t.Fatalf("index is not valid right after listing: %v, %v", cached, ok)
+	}
+	for _, candidate := range cached {
+		if candidate.Name == "dev.yaml" && (candidate.CurrentContext != "dev" || len(candidate.Servers) != 1) {
+			t.Errorf("metadata is not cached: %+v", candidate)
+		}
+	}
+
+	if _, ok := lookupIndex(dir, Source{Path: dir, Detect: DetectBoth}.indexKey(""), dirModTime()); ok {
+		t.Error("index is valid for another detection mode")
+	}
+
+	touch(t, path, time.Minute)
+	if _, ok := lookupIndex(dir, source.indexKey(""), dirModTime()); ok {
+		t.Error("index is valid after a file is modified")
+	}
+	if _, err := ListKubeconfigCandidatesInDir(dir, source, ""); err != nil { // reindex
+		t.Fatal(err)
+	}
+	if _, ok := lookupIndex(dir, source.indexKey(""), dirModTime()); !ok {
+		t.Error("index is not valid after reindexing")
+	}
+
+	writeTestFile(t, dir, "new.yaml", indexTestKubeconfig)
+	touch(t, dir, 2*time.Minute)
+	if _, ok := lookupIndex(dir, source.indexKey(""), dirModTime()); ok {
+		t.Error("index is valid after a file is added")
+	}
+	candidates, _ = ListKubeconfigCandidatesInDir(dir, source, "")
+	if len(candidates) != 3 {
+		t.Errorf("got %d candidates after a file is added, want 3", len(candidates))
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir, 3*time.Minute)
+	candidates, _ = ListKubeconfigCandidatesInDir(dir, source, "")
+	if len(candidates) != 2 {
+		t.Errorf("got %d candidates after a file is removed, want 2", len(candidates))
+	}
+}
+
+func TestSaveIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "dev.yaml", indexTestKubeconfig)
+	if _, err := ListKubeconfigCandidatesInDir(dir, Source{Path: dir, Detect: DetectPattern}, ""); err != nil {
+		t.Fatal(err)
+	}
+	saveIndex()
+
+	f, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := Index{}
+	if err := json.Unmarshal(f, &saved); err != nil {
+		t.Fatal(err)
+	}
+	indexed, ok := saved[dir]
+	if !ok || len(indexed.Files) != 1 || indexed.Files[0].Candidate == nil || indexed.Files[0].Candidate.CurrentContext != "dev" {
+		t.Errorf("unexpected saved index of %s: %+v", dir, indexed)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(kubectlCfConfigDir, ".index-*")); len(matches) != 0 {
+		t.Errorf("temporary index files are left: %v", matches)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -17,16 +19,10 @@ func init() {
 		kubectlCfConfigDir = filepath.Join(kubeDir, "kubectl-cf")
 	}
 
-	previousKubeconfigConfigPath = filepath.Join(kubectlCfConfigDir, PreviousKubeconfigFullPath)
-	var filteredDirPaths []string // Filter out empty items
-	for path := range strings.SplitSeq(os.Getenv("KUBECTL_CF_PATHS"), ":") {
-		if path != "" {
-			filteredDirPaths = append(filteredDirPaths, path)
-		}
-	}
-	kubeconfigDirPaths = filteredDirPaths
-	if len(kubeconfigDirPaths) == 0 { // by default, read kubeconfig files from the directory of the given kubeconfig file
-		kubeconfigDirPaths = []string{KubeconfigSpecialPathKubeconfigDir}
+	setConfigDir(kubectlCfConfigDir)
+
+	if path := os.Getenv("KUBECTL_CF_KEY_FILE"); path != "" {
+		keyFilePath = path
 	}
 
 	kubeconfigPath = os.Getenv("KUBECONFIG")
@@ -47,11 +43,99 @@ func init() {
 	}
 	kubeconfigFilenameMatchPattern = regexp.MustCompile(kubeconfigFilenameMatchPatternStr)
 
+	relativeSymlinks, _ = strconv.ParseBool(os.Getenv("KUBECTL_CF_RELATIVE_SYMLINKS"))
+
+	decryptFilenameMatchPatternStr := os.Getenv("KUBECTL_CF_DECRYPT_MATCH_PATTERN")
+	if decryptFilenameMatchPatternStr == "" {
+		decryptFilenameMatchPatternStr = DecryptFilenameMatchPatternStrDefault
+	}
+	decryptFilenameMatchPattern = regexp.MustCompile(decryptFilenameMatchPatternStr)
+
+	decryptCommand = os.Getenv("KUBECTL_CF_DECRYPT_COMMAND")
+	if decryptCommand == "" {
+		decryptCommand = DecryptCommandDefault
+	}
+
+	decryptInteractive, _ = strconv.ParseBool(os.Getenv("KUBECTL_CF_DECRYPT_INTERACTIVE"))
+
+	decryptCacheTTL = DecryptCacheTTLDefault
+	if ttl := os.Getenv("KUBECTL_CF_DECRYPT_CACHE_TTL"); ttl != "" {
+		parsed, err := parseAge(ttl)
+		if err != nil {
+			logger.Warnf("Invalid KUBECTL_CF_DECRYPT_CACHE_TTL %s, using default %s: %s", ttl, DecryptCacheTTLDefault, err)
+		} else {
+			decryptCacheTTL = parsed
+		}
+	}
+
+	if timeout := os.Getenv("KUBECTL_CF_SOURCE_TIMEOUT"); timeout != "" {
+		parsed, err := parseAge(timeout)
+		if err != nil || parsed <= 0 {
+			logger.Warnf("Invalid KUBECTL_CF_SOURCE_TIMEOUT %s, using default %s", timeout, SourceTimeoutDefault)
+		} else {
+			sourceTimeout = parsed
+		}
+	}
+
+	if loaded, err := LoadConfig(configPath); err != nil {
+		logger.Warnf("Unable to load config, ignored: %s", err)
+	} else {
+		config = loaded
+	}
+
+	if mode := os.Getenv("KUBECTL_CF_DETECT"); mode != "" {
+		if isDetectMode(mode) {
+			defaultDetectMode = mode
+		} else {
+			logger.Warnf("Unknown detection mode %s, expect one of %s", mode, strings.Join(detectModes, ", "))
+		}
+	}
+	for i, source := range config.Sources {
+		if source.Exec != "" && source.execName() == "" {
+			logger.Warnf("Empty exec command of source %d, ignored", i)
+			config.Sources[i].Exec = ""
+		} else if source.Exec != "" && slices.ContainsFunc(config.Sources[:i], func(s Source) bool {
+			return s.Exec != "" && s.execID() == source.execID()
+		}) { // kubeconfigs provided on demand could not tell which source they are from
+			logger.Warnf("Duplicated exec command %s of source %d, ignored", source.Exec, i)
+			config.Sources[i].Exec = ""
+		}
+		if source.Detect != "" && !isDetectMode(source.Detect) {
+			logger.Warnf("Unknown detection mode %s of source %s, expect one of %s", source.Detect, source.Path, strings.Join(detectModes, ", "))
+			config.Sources[i].Detect = ""
+		}
+		if err := config.Sources[i].compile(); err != nil {
+			logger.Warnf("%s, ignored", err)
+		}
+	}
+
+	var filteredSources []Source // Filter out empty items
+	for path := range strings.SplitSeq(os.Getenv("KUBECTL_CF_PATHS"), ":") {
+		if path != "" {
+			filteredSources = append(filteredSources, Source{Path: path})
+		}
+	}
+	kubeconfigSources = append(filteredSources, config.Sources...)
+	if len(kubeconfigSources) == 0 { // by default, read kubeconfig files from the directory of the given kubeconfig file
+		kubeconfigSources = []Source{{Path: KubeconfigSpecialPathKubeconfigDir}}
+	}
+
+	for _, mode := range []string{config.Sort, os.Getenv("KUBECTL_CF_SORT")} {
+		if mode == "" {
+			continue
+		}
+		if !isSortMode(mode) {
+			logger.Warnf("Unknown sort mode %s, expect one of %s", mode, strings.Join(sortModes, ", "))
+			continue
+		}
+		defaultSortMode = mode
+	}
+
 	// ensure config dir exists
 	if _, err := os.Lstat(kubectlCfConfigDir); err != nil {
 		if os.IsNotExist(err) {
 			logger.Debugf("Default config dir %s not exist, creating", kubectlCfConfigDir)
-			if err := os.Mkdir(kubectlCfConfigDir, 0755); err != nil {
+			if err := os.Mkdir(kubectlCfConfigDir, ConfigDirMode); err != nil {
 				panic(err)
 			}
 		} else {
@@ -59,3 +143,19 @@ func init() {
 		}
 	}
 }
+
+// setConfigDir sets the paths of all files kept in the config dir of kubectl-cf
+func setConfigDir(dir string) {
+	kubectlCfConfigDir = dir
+	previousKubeconfigConfigPath = filepath.Join(dir, PreviousKubeconfigFullPath)
+	trashDirPath = filepath.Join(dir, TrashDirName)
+	catalogsDirPath = filepath.Join(dir, CatalogsDirName)
+	journalPath = filepath.Join(dir, JournalFileName)
+	journalLockPath = filepath.Join(dir, JournalLockFileName)
+	configPath = filepath.Join(dir, ConfigFileName)
+	usagePath = filepath.Join(dir, UsageFileName)
+	usageLockPath = filepath.Join(dir, UsageLockFileName)
+	indexPath = filepath.Join(dir, IndexFileName)
+	decryptedIndexPath = filepath.Join(dir, DecryptedIndexFileName)
+	keyFilePath = filepath.Join(dir, KeyFileName)
+}
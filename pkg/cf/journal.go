@@ -0,0 +1,489 @@
+package cf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+// Journal step actions
+const (
+	// StepRename renames From to Path
+	StepRename = "rename"
+	// StepSymlink replaces the symlink Path, Before and After are the targets, nil if the symlink not exist,
+	// runtime files are recorded as the kubeconfig they are decrypted or fetched from, see kubeconfigOfTarget
+	StepSymlink = "symlink"
+	// StepWrite replaces the content of Path, Before and After are the contents, nil if the file not exist
+	StepWrite = "write"
+	// StepCreate creates Path
+	StepCreate = "create"
+)
+
+// JournalStep is a single filesystem mutation made by kubectl-cf
+type JournalStep struct {
+	Action string  `json:"action"`
+	Path   string  `json:"path"`
+	From   string  `json:"from,omitempty"`
+	Before *string `json:"before,omitempty"`
+	After  *string `json:"after,omitempty"`
+}
+
+// JournalEntry is an operation made by kubectl-cf, consisting of one or more steps
+type JournalEntry struct {
+	ID          int64         `json:"id"`
+	Time        time.Time     `json:"time"`
+	Description string        `json:"description"`
+	Steps       []JournalStep `json:"steps"`
+
+	// Undoes is the ID of the entry reverted by this entry, 0 if this entry is not an undo
+	Undoes int64 `json:"undoes,omitempty"`
+}
+
+// Operation records the steps of an operation, steps are performed through its methods,
+// and the operation is appended to the journal by Commit
+type Operation struct {
+	entry JournalEntry
+}
+
+// beginOperation starts an operation with a description for humans
+func beginOperation(description string) *Operation {
+	now := time.Now()
+	return &Operation{entry: JournalEntry{ID: now.UnixNano(), Time: now, Description: description}}
+}
+
+func (o *Operation) record(step JournalStep) {
+	o.entry.Steps = append(o.entry.Steps, step)
+}
+
+// readOptional reads a file or the target of a symlink, returns nil if not exist
+func readOptional(path string, read func(string) (string, error)) (*string, error) {
+	content, err := read(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &content, nil
+}
+
+func readFileString(path string) (string, error) {
+	f, err := os.ReadFile(path)
+	return string(f), err
+}
+
+// Rename moves from to to
+func (o *Operation) Rename(from, to string) error {
+	if err := sys.MoveFile(from, to); err != nil {
+		return err
+	}
+	o.record(JournalStep{Action: StepRename, From: from, Path: to})
+	return nil
+}
+
+// MoveToTrash moves path into the trash dir, returns the path in the trash dir
+func (o *Operation) MoveToTrash(path string) (string, error) {
+	if err := os.MkdirAll(trashDirPath, ConfigDirMode); err != nil {
+		return "", errors.Wrap(err, "create trash dir error")
+	}
+	trashPath, err := sys.GenerateBackUpName(filepath.Join(trashDirPath, filepath.Base(path)), "")
+	if err != nil {
+		return "", err
+	}
+	return trashPath, o.Rename(path, trashPath)
+}
+
+// Create copies src to the new file path
+func (o *Operation) Create(src, path string) error {
+	if err := sys.CopyFile(src, path); err != nil {
+		return err
+	}
+	o.record(JournalStep{Action: StepCreate, Path: path})
+	return nil
+}
+
+// WriteFile writes content to path, content nil means removing the file
+func (o *Operation) WriteFile(path string, content *string, perm os.FileMode) error {
+	before, err := readOptional(path, readFileString)
+	if err != nil {
+		return errors.Wrap(err, "os.ReadFile error")
+	}
+	if content == nil {
+		if before == nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return errors.Wrap(err, "os.Remove error")
+		}
+	} else if err := os.WriteFile(path, []byte(*content), perm); err != nil {
+		return errors.Wrap(err, "os.WriteFile error")
+	}
+	o.record(JournalStep{Action: StepWrite, Path: path, Before: before, After: content})
+	return nil
+}
+
+// CreateSymlink is sys.CreateSymlink with the backup and the symlink replacement recorded
+func (o *Operation) CreateSymlink(target, link string) error {
+	return o.symlink(target, link, sys.CreateSymlink)
+}
+
+// ReplaceSymlink is sys.ReplaceSymlink with the backup and the symlink replacement recorded
+func (o *Operation) ReplaceSymlink(target, link string) error {
+	return o.symlink(target, link, sys.ReplaceSymlink)
+}
+
+// kubeconfigOfTarget returns the kubeconfig which the symlink link pointing to target stands for:
+// runtime files are replaced by the kubeconfig they are decrypted or fetched from, which outlives them,
+// other targets are returned as is
+func kubeconfigOfTarget(link, target string) string {
+	path := target
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(link), path)
+	}
+	if source := sourceOfRuntimeFile(path); source != path {
+		return source
+	}
+	return target
+}
+
+// readSymlinkKubeconfig reads the target of the symlink link as kubeconfigOfTarget, returns nil if not exist
+func readSymlinkKubeconfig(link string) (*string, error) {
+	return readOptional(link, func(link string) (string, error) {
+		target, err := os.Readlink(link)
+		return kubeconfigOfTarget(link, target), err
+	})
+}
+
+func (o *Operation) symlink(target, link string, create func(string, string) (string, error)) error {
+	before, err := readSymlinkKubeconfig(link)
+	if err != nil {
+		before = nil // not a symlink, will be backed up
+	}
+	backupPath, err := create(target, link)
+	if backupPath != "" {
+		o.record(JournalStep{Action: StepRename, From: link, Path: backupPath})
+	}
+	if err != nil {
+		return err
+	}
+	after := kubeconfigOfTarget(link, target)
+	o.record(JournalStep{Action: StepSymlink, Path: link, Before: before, After: &after})
+	return nil
+}
+
+// ReplaceSymlinkWithFile atomically replaces the symlink link with the regular file src by renaming,
+// if keepSrc is true, src is copied next to link first, so src itself is kept
+func (o *Operation) ReplaceSymlinkWithFile(src, link string, keepSrc bool) error {
+	before, err := readSymlinkKubeconfig(link)
+	if err != nil || before == nil {
+		return errors.Wrapf(err, "os.Readlink error for %s", link)
+	}
+	if keepSrc {
+		tmpPath, err := sys.GenerateBackUpName(link+".tmp", "")
+		if err != nil {
+			return err
+		}
+		if err := o.Create(src, tmpPath); err != nil {
+			return err
+		}
+		src = tmpPath
+	}
+	if err := os.Rename(src, link); err != nil {
+		return errors.Wrap(err, "os.Rename error")
+	}
+	o.record(JournalStep{Action: StepSymlink, Path: link, Before: before})
+	o.record(JournalStep{Action: StepRename, From: src, Path: link})
+	return nil
+}
+
+// Commit appends the operation to the journal, operations without steps are not recorded.
+// A failure to write the journal does not fail the operation, it is only logged.
+func (o *Operation) Commit() {
+	if len(o.entry.Steps) == 0 {
+		return
+	}
+	if err := appendJournal(o.entry); err != nil {
+		logger.Warnf("Unable to write journal %s: %s", journalPath, err)
+	}
+}
+
+// lockConfigFile locks the lock file at path in kubectl-cf config dir, blocks until it is locked,
+// other kubectl-cf processes wait for unlock before they read or write the files guarded by the lock file
+func lockConfigFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, ConfigFileMode)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.OpenFile error")
+	}
+	if err := sys.LockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() { _ = f.Close() }, nil // closing releases the lock as well
+}
+
+// appendJournal appends entry to the journal, and drops the oldest entries if there are more than JournalMaxEntries
+func appendJournal(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+	unlock, err := lockConfigFile(journalLockPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, ConfigFileMode)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile error")
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "write journal error")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "write journal error")
+	}
+	return trimJournal()
+}
+
+// trimJournal keeps the latest JournalMaxEntries entries in the journal, the journal is replaced atomically
+func trimJournal() error {
+	entries, err := ReadJournal()
+	if err != nil || len(entries) <= JournalMaxEntries {
+		return err
+	}
+	var b bytes.Buffer
+	for _, entry := range entries[len(entries)-JournalMaxEntries:] {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "json.Marshal error")
+		}
+		b.Write(append(line, '\n'))
+	}
+	tmp, err := os.CreateTemp(kubectlCfConfigDir, ".journal-*") // created with mode 0600
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp error")
+	}
+	_, err = tmp.Write(b.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), journalPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(err, "trim journal error")
+	}
+	return nil
+}
+
+// ReadJournal reads all entries in the journal, oldest first
+func ReadJournal() ([]JournalEntry, error) {
+	f, err := os.ReadFile(journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(f))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Wrap(err, "corrupted journal")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Wrap(scanner.Err(), "read journal error")
+}
+
+// undoneEntries returns the IDs of entries which are undone
+func undoneEntries(entries []JournalEntry) map[int64]bool {
+	undone := map[int64]bool{}
+	for _, entry := range entries {
+		if entry.Undoes != 0 {
+			undone[entry.Undoes] = true
+		}
+	}
+	return undone
+}
+
+// lastUndoableEntry returns the latest entry which is neither an undo nor undone, nil if not found
+func lastUndoableEntry(entries []JournalEntry) *JournalEntry {
+	undone := undoneEntries(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Undoes == 0 && !undone[entries[i].ID] {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func equalOptional(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// verifyEntry checks that the steps of entry are still in effect, so they can be reverted exactly,
+// and that the kubeconfig files symlinks pointed to before still exist,
+// paths touched again by a later step of the same entry are checked against the later step only
+func verifyEntry(entry JournalEntry) error {
+	touchedLater := func(i int, path string) bool {
+		for _, later := range entry.Steps[i+1:] {
+			if later.Path == path || later.From == path {
+				return true
+			}
+		}
+		return false
+	}
+	for i, step := range entry.Steps {
+		if !touchedLater(i, step.Path) {
+			if err := step.verifyPath(); err != nil {
+				return err
+			}
+		}
+		if step.Action == StepRename && !touchedLater(i, step.From) {
+			if _, err := os.Lstat(step.From); err == nil {
+				return errors.New(t("fileAlreadyExists", step.From))
+			}
+		}
+		if step.Action == StepSymlink && step.Before != nil && *step.Before != "" && !isExecPath(*step.Before) {
+			before := *step.Before
+			if !filepath.IsAbs(before) {
+				before = filepath.Join(filepath.Dir(step.Path), before)
+			}
+			if _, err := os.Stat(before); err != nil && !touchedLater(i, before) {
+				return errors.New(t("journalKubeconfigMissing", before, step.Path))
+			}
+		}
+	}
+	return nil
+}
+
+// verifyPath checks that Path is still in the state after the step
+func (step JournalStep) verifyPath() error {
+	var current *string
+	var err error
+	switch step.Action {
+	case StepRename, StepCreate:
+		_, err = os.Lstat(step.Path)
+		if err == nil {
+			return nil
+		}
+	case StepSymlink:
+		current, err = readSymlinkKubeconfig(step.Path)
+	case StepWrite:
+		current, err = readOptional(step.Path, readFileString)
+	default:
+		return errors.Errorf("unknown journal action %s", step.Action)
+	}
+	if err != nil || !equalOptional(current, step.After) {
+		return errors.New(t("journalStepChanged", step.Path))
+	}
+	return nil
+}
+
+// revert reverts the step, the revert is recorded in o
+func (o *Operation) revert(step JournalStep) error {
+	switch step.Action {
+	case StepRename:
+		return o.Rename(step.Path, step.From)
+	case StepCreate: // created files are moved to trash rather than removed
+		_, err := o.MoveToTrash(step.Path)
+		return err
+	case StepSymlink:
+		return o.revertSymlink(step)
+	case StepWrite:
+		return o.WriteFile(step.Path, step.Before, ConfigFileMode)
+	default:
+		return errors.Errorf("unknown journal action %s", step.Action)
+	}
+}
+
+// revertSymlink points the symlink back to the kubeconfig before the step,
+// encrypted kubeconfigs and kubeconfigs provided on demand are decrypted or fetched again,
+// and the runtime file which the symlink pointed to is wiped
+func (o *Operation) revertSymlink(step JournalStep) error {
+	replaced, _ := os.Readlink(step.Path)
+	if step.Before == nil {
+		if err := os.Remove(step.Path); err != nil {
+			return errors.Wrap(err, "os.Remove error")
+		}
+		o.record(JournalStep{Action: StepSymlink, Path: step.Path, Before: step.After})
+		wipeReplacedRuntimeFile(replaced, "")
+		return nil
+	}
+
+	target := *step.Before
+	var passphrase string
+	if isEncryptedPath(target) {
+		if ok, err := needsPassphrase(target); err != nil {
+			return err
+		} else if ok {
+			if passphrase, err = readPassphrase(t("passphrasePrompt")); err != nil {
+				return err
+			}
+		}
+	}
+	runtimeTarget, err := runtimeTargetOf(target, passphrase)
+	if err != nil {
+		return err
+	}
+	if runtimeTarget != target {
+		target = symlinkTarget(runtimeTarget)
+	}
+	if err := o.ReplaceSymlink(target, step.Path); err != nil {
+		return err
+	}
+	wipeReplacedRuntimeFile(replaced, runtimeTarget)
+	return nil
+}
+
+// Undo reverts all steps of entry in reverse order, the undo itself is appended to the journal
+func Undo(entry JournalEntry) error {
+	if err := verifyEntry(entry); err != nil {
+		return err
+	}
+	o := beginOperation(t("undoDescription", entry.Description))
+	o.entry.Undoes = entry.ID
+	defer o.Commit()
+	for i := len(entry.Steps) - 1; i >= 0; i-- {
+		if err := o.revert(entry.Steps[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runUndo implements "cf undo"
+func runUndo(_ []string) error {
+	entries, err := ReadJournal()
+	if err != nil {
+		return err
+	}
+	entry := lastUndoableEntry(entries)
+	if entry == nil {
+		return errors.New(t("nothingToUndo"))
+	}
+	if err := Undo(*entry); err != nil {
+		return errors.New(t("undoError", entry.Description, err.Error()))
+	}
+	fmt.Println(text(t("undone", info(entry.Description), entry.Time.Format(time.DateTime))))
+	return nil
+}
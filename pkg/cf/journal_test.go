@@ -0,0 +1,247 @@
+package cf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/junchaw/kubectl-cf/pkg/crypt"
+)
+
+// resetKubeconfigSymlink points the kubeconfig symlink to target and clears the journal
+func resetKubeconfigSymlink(t *testing.T, target string) {
+	t.Helper()
+	_ = os.Remove(kubeconfigPath)
+	_ = os.Remove(journalPath)
+	if err := os.Symlink(target, kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lastEntry returns the last undoable entry of the journal
+func lastEntry(t *testing.T) JournalEntry {
+	t.Helper()
+	entries, err := ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := lastUndoableEntry(entries)
+	if entry == nil {
+		t.Fatal("nothing to undo")
+	}
+	return *entry
+}
+
+// writeEncryptedTestFile encrypts content for the key file, which is generated if not exist
+func writeEncryptedTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	identity, err := loadIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity == nil {
+		if identity, err = crypt.GenerateX25519Identity(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyFilePath, []byte(identity.String()+"\n"), ConfigFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encrypted, err := crypt.Encrypt([]byte(content), identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTestFile(t, dir, name, string(encrypted))
+}
+
+func readLink(t *testing.T, link string) string {
+	t.Helper()
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestUndoSwitch(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.yaml", "a")
+	b := writeTestFile(t, dir, "b.yaml", "b")
+	resetKubeconfigSymlink(t, a)
+
+	modal := &KubectlCfModal{currentKubeconfigPath: a}
+	modal.symlinkConfigPathTo(b)
+	if target := readLink(t, kubeconfigPath); target != b {
+		t.Fatalf("symlink points to %s, want %s", target, b)
+	}
+	if previous, _ := readPreviousKubeconfigPath(); previous != a {
+		t.Errorf("previous is %s, want %s", previous, a)
+	}
+
+	if err := Undo(lastEntry(t)); err != nil {
+		t.Fatal(err)
+	}
+	if target := readLink(t, kubeconfigPath); target != a {
+		t.Errorf("symlink points to %s after undo, want %s", target, a)
+	}
+	if _, err := os.Stat(previousKubeconfigConfigPath); !os.IsNotExist(err) {
+		t.Errorf("previous file is not removed by undo")
+	}
+	entries, _ := ReadJournal()
+	if lastUndoableEntry(entries) != nil {
+		t.Errorf("undone entry is still undoable")
+	}
+}
+
+func TestUndoSwitchToEncryptedKubeconfigWipesRuntimeFile(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.yaml", "a")
+	b := writeEncryptedTestFile(t, dir, "b.yaml"+EncryptedFileSuffix, "b")
+	resetKubeconfigSymlink(t, a)
+
+	(&KubectlCfModal{currentKubeconfigPath: a}).symlinkConfigPathTo(b)
+	runtimeFile := readLink(t, kubeconfigPath)
+	if content, err := os.ReadFile(runtimeFile); err != nil || string(content) != "b" {
+		t.Fatalf("unexpected runtime file %s: %q, %v", runtimeFile, content, err)
+	}
+	entry := lastEntry(t)
+	if step := entry.Steps[len(entry.Steps)-1]; step.After == nil || *step.After != b {
+		t.Errorf("journal records %v as the symlink target, want the encrypted kubeconfig %s", step.After, b)
+	}
+
+	if err := Undo(entry); err != nil {
+		t.Fatal(err)
+	}
+	if target := readLink(t, kubeconfigPath); target != a {
+		t.Errorf("symlink points to %s after undo, want %s", target, a)
+	}
+	if _, err := os.Stat(runtimeFile); !os.IsNotExist(err) {
+		t.Errorf("runtime file %s is not wiped by undo", runtimeFile)
+	}
+}
+
+func TestUndoSwitchFromEncryptedKubeconfigDecryptsAgain(t *testing.T) {
+	dir := t.TempDir()
+	a := writeEncryptedTestFile(t, dir, "a.yaml"+EncryptedFileSuffix, "a")
+	b := writeTestFile(t, dir, "b.yaml", "b")
+	resetKubeconfigSymlink(t, b)
+
+	(&KubectlCfModal{currentKubeconfigPath: b}).symlinkConfigPathTo(a)
+	(&KubectlCfModal{currentKubeconfigPath: a}).symlinkConfigPathTo(b)
+
+	if err := Undo(lastEntry(t)); err != nil {
+		t.Fatal(err)
+	}
+	runtimeFile := readLink(t, kubeconfigPath)
+	if content, err := os.ReadFile(runtimeFile); err != nil || string(content) != "a" {
+		t.Errorf("symlink points to %s after undo with content %q, %v, want a decrypted copy of %s", runtimeFile, content, err, a)
+	}
+	if source := sourceOfRuntimeFile(runtimeFile); source != a {
+		t.Errorf("runtime file is decrypted from %s, want %s", source, a)
+	}
+}
+
+func TestUndoRefusesMissingKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "a.yaml", "a")
+	b := writeTestFile(t, dir, "b.yaml", "b")
+	resetKubeconfigSymlink(t, a)
+
+	(&KubectlCfModal{currentKubeconfigPath: a}).symlinkConfigPathTo(b)
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(lastEntry(t)); err == nil {
+		t.Error("expect undo to refuse, the kubeconfig switched away from no longer exists")
+	}
+	if target := readLink(t, kubeconfigPath); target != b {
+		t.Errorf("symlink points to %s after refused undo, want %s", target, b)
+	}
+}
+
+func TestUndoRefusesChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	content := "a"
+
+	o := beginOperation("write")
+	if err := o.WriteFile(path, &content, ConfigFileMode); err != nil {
+		t.Fatal(err)
+	}
+	o.Commit()
+	if err := os.WriteFile(path, []byte("changed"), ConfigFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(lastEntry(t)); err == nil {
+		t.Error("expect undo to refuse, the file has changed")
+	}
+}
+
+func TestUndoMoveToTrash(t *testing.T) {
+	_ = os.Remove(journalPath)
+	path := writeTestFile(t, t.TempDir(), "a.yaml", "a")
+
+	o := beginOperation("delete")
+	trashPath, err := o.MoveToTrash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Commit()
+	if filepath.Dir(trashPath) != trashDirPath {
+		t.Errorf("%s is not in the trash dir %s", trashPath, trashDirPath)
+	}
+
+	if err := Undo(lastEntry(t)); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "a" {
+		t.Errorf("file is not restored by undo: %q, %v", content, err)
+	}
+}
+
+func TestAppendJournalDropsOldestEntries(t *testing.T) {
+	_ = os.Remove(journalPath)
+	t.Cleanup(func() { _ = os.Remove(journalPath) })
+	var full []byte
+	for i := range JournalMaxEntries {
+		line, err := json.Marshal(JournalEntry{ID: int64(i + 1), Time: time.Now(), Description: "old"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		full = append(append(full, line...), '\n')
+	}
+	if err := os.WriteFile(journalPath, full, ConfigFileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		description string
+		firstID     int64
+	}{
+		{"first", 2},
+		{"second", 3},
+	} {
+		path := writeTestFile(t, t.TempDir(), "a.yaml", "a")
+		o := beginOperation(c.description)
+		if _, err := o.MoveToTrash(path); err != nil {
+			t.Fatal(err)
+		}
+		o.Commit()
+
+		entries, err := ReadJournal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != JournalMaxEntries || entries[0].ID != c.firstID {
+			t.Fatalf("got %d entries from %d after appending %s, want %d from %d", len(entries), entries[0].ID, c.description, JournalMaxEntries, c.firstID)
+		}
+		if entry := lastEntry(t); entry.Description != c.description {
+			t.Errorf("got the last entry %s, want %s", entry.Description, c.description)
+		}
+	}
+	if temps, _ := filepath.Glob(filepath.Join(kubectlCfConfigDir, ".journal-*")); len(temps) != 0 {
+		t.Errorf("temporary files are left: %v", temps)
+	}
+}
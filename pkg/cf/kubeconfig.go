@@ -0,0 +1,179 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/junchaw/kubectl-cf/pkg/crypt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Kubeconfig is the subset of a kubeconfig file that kubectl-cf cares about
+type Kubeconfig struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	CurrentContext string         `yaml:"current-context"`
+	Clusters       []NamedCluster `yaml:"clusters"`
+	Contexts       []NamedContext `yaml:"contexts"`
+	Users          []NamedUser    `yaml:"users"`
+}
+
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+type Cluster struct {
+	Server                   string `yaml:"server"`
+	ProxyURL                 string `yaml:"proxy-url"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+}
+
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+type Context struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+type NamedUser struct {
+	Name string   `yaml:"name"`
+	User AuthInfo `yaml:"user"`
+}
+
+type AuthInfo struct {
+	ClientCertificate     string        `yaml:"client-certificate"`
+	ClientCertificateData string        `yaml:"client-certificate-data"`
+	ClientKey             string        `yaml:"client-key"`
+	ClientKeyData         string        `yaml:"client-key-data"`
+	Token                 string        `yaml:"token"`
+	TokenFile             string        `yaml:"tokenFile"`
+	Username              string        `yaml:"username"`
+	Password              string        `yaml:"password"`
+	AuthProvider          *AuthProvider `yaml:"auth-provider"`
+	Exec                  *ExecConfig   `yaml:"exec"`
+}
+
+type AuthProvider struct {
+	Name string `yaml:"name"`
+}
+
+type ExecConfig struct {
+	Command string `yaml:"command"`
+}
+
+// AuthMethod returns a short, secret-free description of how the user authenticates
+func (a AuthInfo) AuthMethod() string {
+	switch {
+	case a.Exec != nil:
+		return "exec: " + a.Exec.Command
+	case a.AuthProvider != nil:
+		return "auth-provider: " + a.AuthProvider.Name
+	case a.Token != "":
+		return "token"
+	case a.TokenFile != "":
+		return "token file: " + a.TokenFile
+	case a.ClientCertificateData != "" || a.ClientCertificate != "":
+		return "client certificate"
+	case a.Username != "" || a.Password != "":
+		return "basic auth"
+	default:
+		return "none"
+	}
+}
+
+// Cluster returns the cluster with the given name, nil if not found
+func (k *Kubeconfig) Cluster(name string) *Cluster {
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == name {
+			return &k.Clusters[i].Cluster
+		}
+	}
+	return nil
+}
+
+// User returns the user with the given name, nil if not found
+func (k *Kubeconfig) User(name string) *AuthInfo {
+	for i := range k.Users {
+		if k.Users[i].Name == name {
+			return &k.Users[i].User
+		}
+	}
+	return nil
+}
+
+// Providers detected by Kubeconfig.Provider
+const (
+	ProviderEKS   = "eks"
+	ProviderGKE   = "gke"
+	ProviderAKS   = "aks"
+	ProviderLocal = "local"
+	ProviderOther = "other"
+)
+
+// Provider guesses the cloud provider of the current context (or the first cluster if there is no current context)
+// by the server address and the authentication
+func (k *Kubeconfig) Provider() string {
+	var cluster *Cluster
+	var user *AuthInfo
+	for _, c := range k.Contexts {
+		if c.Name == k.CurrentContext {
+			cluster, user = k.Cluster(c.Context.Cluster), k.User(c.Context.User)
+		}
+	}
+	if cluster == nil && len(k.Clusters) > 0 {
+		cluster = &k.Clusters[0].Cluster
+	}
+
+	var server, command, authProvider string
+	if cluster != nil {
+		server = cluster.Server
+	}
+	if user != nil && user.Exec != nil {
+		command = filepath.Base(user.Exec.Command)
+	}
+	if user != nil && user.AuthProvider != nil {
+		authProvider = user.AuthProvider.Name
+	}
+	switch {
+	case strings.Contains(server, ".eks.amazonaws.com") || command == "aws" || command == "aws-iam-authenticator":
+		return ProviderEKS
+	case command == "gke-gcloud-auth-plugin" || authProvider == "gcp":
+		return ProviderGKE
+	case strings.Contains(server, ".azmk8s.io") || command == "kubelogin" || authProvider == "azure":
+		return ProviderAKS
+	case strings.Contains(server, "://localhost") || strings.Contains(server, "://127.0.0.1") || strings.Contains(server, "://[::1]"):
+		return ProviderLocal
+	default:
+		return ProviderOther
+	}
+}
+
+// ParseKubeconfig parses kubeconfig content
+func ParseKubeconfig(content []byte) (*Kubeconfig, error) {
+	var kubeconfig Kubeconfig
+	if err := yaml.Unmarshal(content, &kubeconfig); err != nil {
+		return nil, errors.Wrap(err, "yaml.Unmarshal error")
+	}
+	return &kubeconfig, nil
+}
+
+// ParseKubeconfigFile reads and parses a kubeconfig file
+func ParseKubeconfigFile(path string) (*Kubeconfig, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if crypt.IsEncrypted(f) || isExternallyEncryptedPath(path) {
+		return nil, errors.New(t("kubeconfigIsEncrypted", path))
+	}
+	return ParseKubeconfig(f)
+}
@@ -1,28 +1,104 @@
 package cf
 
 import (
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/junchaw/kubectl-cf/pkg/sys"
 	"github.com/pkg/errors"
 )
 
 type Candidate struct {
 	Name     string
 	FullPath string
+
+	// Warnings are the security issues found in the file, see auditFile
+	Warnings []string
+
+	// Encrypted is true if the file is encrypted, see EncryptedFileSuffix and decryptFilenameMatchPattern
+	Encrypted bool
+
+	// Source is the directory expanded from kubeconfigSources where the file is found, see sourceDirs
+	Source string
+
+	// Origin is the source the candidate is found in, with its path expanded to Source for directory sources,
+	// its pattern and excludes tell which file names are listed, see Candidate.checkFileName
+	Origin Source
+
+	// Tags are the tags of the candidate from the config file, see Config.Tags
+	Tags []string
+
+	// Provider is the cloud provider guessed from the content, see Kubeconfig.Provider,
+	// empty if the file can not be parsed
+	Provider string
+
+	// ModTime is the modification time of the file
+	ModTime time.Time
+
+	// CurrentContext, Contexts and Servers are parsed from the file, empty if it can not be parsed
+	CurrentContext string
+	Contexts       []string
+	Servers        []string
+
+	// ShadowedBy is the full path of the candidate with the same name in an earlier source,
+	// like PATH, the first source wins, empty if the candidate is not shadowed
+	ShadowedBy string
+
+	// Qualifier is the trailing segments of Source which tell it apart from the sources of other candidates
+	// with the same name, see qualifyNames, the base name of Source if empty
+	Qualifier string
+
+	// Summary is the description of a candidate provided by an exec source, shown instead of the path, could be empty
+	Summary string
 }
 
-func (c Candidate) Title() string {
+// QualifiedName returns the name qualified by its source, like "work/prod",
+// or "a/kube/prod" and "b/kube/prod" for sources "~/clients/a/kube" and "~/clients/b/kube",
+// it is unique unless files with the same name are found in the same source
+func (c Candidate) QualifiedName() string {
+	qualifier := c.Qualifier
+	if qualifier == "" {
+		qualifier = filepath.Base(c.Source)
+	}
+	return qualifier + "/" + c.Name
+}
+
+// DisplayName returns the qualified name for shadowed candidates, the name otherwise
+func (c Candidate) DisplayName() string {
+	if c.ShadowedBy != "" {
+		return c.QualifiedName()
+	}
 	return c.Name
 }
 
+func (c Candidate) Title() string {
+	title := c.DisplayName()
+	if c.ShadowedBy != "" {
+		title += " " + subtle(t("shadowed"))
+	}
+	if c.Encrypted {
+		title += " 🔒"
+	}
+	if len(c.Warnings) > 0 {
+		title += " " + warning("⚠")
+	}
+	return title
+}
+
 func (c Candidate) Description() string {
+	if c.Summary != "" {
+		return c.Summary
+	}
 	return "Path: " + c.FullPath
 }
 
 func (c Candidate) FilterValue() string {
-	return c.Name
+	return c.DisplayName()
 }
 
 type Candidates []Candidate
@@ -35,41 +111,166 @@ func (c Candidates) ToListItems() []list.Item {
 	return items
 }
 
-// ListKubeconfigCandidatesInDir lists all files in dir that matches KubeconfigFilenamePattern
-func ListKubeconfigCandidatesInDir(dir string) ([]Candidate, error) {
+// Guess returns the candidates whose name or qualified name equals arg, shadowed candidates only match by qualified name,
+// more than one candidate is returned if the qualified name is ambiguous,
+// if there is no such candidate, returns all candidates whose display name starts with arg,
+// or whose qualified name starts with arg if arg is qualified like "work/prod"
+func (c Candidates) Guess(arg string) []Candidate {
+	var guessCandidates []Candidate
+	for _, candidate := range c {
+		if (candidate.Name == arg && candidate.ShadowedBy == "") || candidate.QualifiedName() == arg {
+			guessCandidates = append(guessCandidates, candidate)
+		}
+	}
+	if guessCandidates != nil {
+		return guessCandidates
+	}
+	for _, candidate := range c {
+		qualified := strings.Contains(arg, "/") && strings.HasPrefix(candidate.QualifiedName(), arg)
+		if strings.HasPrefix(candidate.DisplayName(), arg) || qualified { // guess candidates by prefix
+			guessCandidates = append(guessCandidates, candidate)
+		}
+	}
+	return guessCandidates
+}
+
+// ListKubeconfigCandidates lists candidates in all kubeconfigSources concurrently, see scanSources,
+// currentKubeconfigPath is used to resolve the special path KubeconfigSpecialPathKubeconfigDir.
+// Sources which can not be read in time are returned as errors, candidates in other sources are still listed.
+func ListKubeconfigCandidates(currentKubeconfigPath string) (Candidates, []SourceError) {
+	return mergeScans(scanSources(currentKubeconfigPath))
+}
+
+// ReadCurrentKubeconfigPath returns the target of the kubeconfig symlink,
+// or the encrypted kubeconfig if the target is decrypted from it,
+// empty if the kubeconfig does not exist or is not a symlink
+func ReadCurrentKubeconfigPath() (string, error) {
+	stat, err := os.Lstat(kubeconfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "os.Lstat error")
+	}
+	if !sys.IsSymlink(stat) {
+		return "", nil
+	}
+	target, err := os.Readlink(kubeconfigPath)
+	if err != nil {
+		return "", errors.Wrap(err, "os.Readlink error")
+	}
+	return sourceOfRuntimeFile(resolveSymlinkTarget(target)), nil
+}
+
+// resolveSymlinkTarget resolves a relative target of the kubeconfig symlink to an absolute path
+func resolveSymlinkTarget(target string) string {
+	if target == "" || filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(kubeconfigPath), target)
+}
+
+// symlinkTarget returns the target to write into the kubeconfig symlink for path,
+// if relativeSymlinks is enabled and path is inside the directory of the kubeconfig,
+// the target is relative to it, otherwise the target is path itself
+func symlinkTarget(path string) string {
+	if !relativeSymlinks || path == "" {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	absKubeconfigDir, err := filepath.Abs(kubeconfigDir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absKubeconfigDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// ListKubeconfigCandidatesInDir lists all files in dir detected as kubeconfig files by the detection mode
+// and the match pattern of source, see Source.Detect and Source.Pattern, named by the name template of source,
+// encrypted files are matched without EncryptedFileSuffix, and files encrypted by an external tool
+// are matched by decryptFilenameMatchPattern as well, named by their file names.
+// Files excluded by source are skipped before they are read, rel is the path of dir relative to the source,
+// see Source.excluded.
+// The result is cached in the index with the parsed metadata, and reused while dir and the files in it are not changed.
+func ListKubeconfigCandidatesInDir(dir string, source Source, rel string) ([]Candidate, error) {
+	dirStat, err := os.Stat(dir) // before reading the dir, so a change during the reading invalidates the index
+	if err != nil {
+		return nil, errors.Wrap(err, "os.Stat error")
+	}
+	key := source.indexKey(rel)
+	if candidates, ok := lookupIndex(dir, key, dirStat.ModTime()); ok {
+		return candidates, nil
+	}
+
 	fileInfo, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, errors.Wrap(err, "os.ReadDir error")
 	}
 
+	indexed := &IndexedDir{ModTime: dirStat.ModTime(), Key: key}
 	var files []Candidate
 	for _, file := range fileInfo {
-		if file.IsDir() {
+		if !file.Type().IsRegular() && file.Type()&fs.ModeSymlink == 0 { // directories, and pipes which block on read
+			continue
+		}
+		if source.excluded(path.Join(rel, file.Name()), false) { // never read, nor indexed
 			continue
 		}
 
-		groupNames := kubeconfigFilenameMatchPattern.SubexpNames() // regex match groups
+		pattern := source.matchPattern()
+		groupNames := pattern.SubexpNames() // regex match groups
 		nameGroupIndex := 0
 		for i, name := range groupNames {
-			if name == KubeconfigFilenameMatchPatternNameGroup { // find the "name" group index
+			if name == source.nameGroup() { // find the "name" group index
 				nameGroupIndex = i
 				break
 			}
 		} // if there is no "name" group, will use the whole config file name
 
-		matches := kubeconfigFilenameMatchPattern.FindStringSubmatch(file.Name())
-		if len(matches) >= 2 {
-			absPath, err := filepath.Abs(filepath.Join(dir, file.Name()))
-			if err != nil {
-				return nil, errors.Wrapf(err, "filepath.Abs error for %s", file.Name())
-			}
-			files = append(files, Candidate{
+		matchName := strings.TrimSuffix(file.Name(), EncryptedFileSuffix)
+		name := matchName // detected by content only, use the whole config file name
+		if source.Detect != DetectContent {
+			matches := pattern.FindStringSubmatch(matchName)
+			if len(matches) >= 2 {
 				// Use the last match group as the name, if there is no match group in the regex,
 				// will use the whole config file name, I think this is the best we can do with different regex.
-				Name:     matches[nameGroupIndex],
-				FullPath: absPath,
-			})
+				name = matches[nameGroupIndex]
+			} else if !isExternallyEncryptedPath(file.Name()) {
+				continue
+			}
+		}
+
+		absPath, err := filepath.Abs(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "filepath.Abs error for %s", file.Name())
+		}
+		indexedFile := IndexedFile{FileName: file.Name()}
+		if stat, err := os.Stat(absPath); err == nil {
+			indexedFile.ModTime, indexedFile.Size = stat.ModTime(), stat.Size()
+		} else {
+			indexedFile.Size = -1 // never valid, like a dangling symlink
+		}
+		if source.Detect != DetectPattern && !looksLikeKubeconfig(absPath) {
+			indexed.Files = append(indexed.Files, indexedFile)
+			continue
+		}
+		candidate := Candidate{
+			Name:      name,
+			FullPath:  absPath,
+			Encrypted: matchName != file.Name() || isExternallyEncryptedPath(file.Name()),
 		}
+		candidate.Name = source.renderName(candidate)
+		indexedFile.Candidate = indexCandidate(candidate)
+		indexed.Files = append(indexed.Files, indexedFile)
+		files = append(files, indexedFile.Candidate.toCandidate(absPath, indexedFile.ModTime))
 	}
+	storeIndex(dir, indexed)
 	return files, nil
 }
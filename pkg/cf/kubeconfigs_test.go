@@ -0,0 +1,92 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestListKubeconfigCandidatesInDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config", "a.yaml", "b.yml", "c.enc.yaml", "d.yaml" + EncryptedFileSuffix, "e.tar.gz"} {
+		writeTestFile(t, dir, name, "")
+	}
+	if err := os.Mkdir(filepath.Join(dir, "f.yaml"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := ListKubeconfigCandidatesInDir(dir, Source{Path: dir, Detect: DetectPattern}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, candidate := range candidates {
+		if candidate.FullPath != filepath.Join(dir, filepath.Base(candidate.FullPath)) {
+			t.Errorf("unexpected path %s", candidate.FullPath)
+		}
+		name := candidate.Name
+		if candidate.Encrypted {
+			name += " (encrypted)"
+		}
+		got = append(got, name)
+	}
+	slices.Sort(got)
+	want := []string{"a.yaml", "c.enc.yaml (encrypted)", "config", "d.yaml (encrypted)"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSymlinkTarget(t *testing.T) {
+	enabled := relativeSymlinks
+	t.Cleanup(func() { relativeSymlinks = enabled })
+	outside := t.TempDir()
+
+	for _, c := range []struct {
+		relative bool
+		path     string
+		want     string
+	}{
+		{false, filepath.Join(kubeconfigDir, "prod.yaml"), filepath.Join(kubeconfigDir, "prod.yaml")},
+		{true, filepath.Join(kubeconfigDir, "prod.yaml"), "prod.yaml"},
+		{true, filepath.Join(kubeconfigDir, "team", "..", "team", "prod.yaml"), filepath.Join("team", "prod.yaml")},
+		{true, filepath.Join(outside, "prod.yaml"), filepath.Join(outside, "prod.yaml")},
+		{true, filepath.Join(kubeconfigDir, "..", "prod.yaml"), filepath.Join(kubeconfigDir, "..", "prod.yaml")}, // outside by ".."
+		{true, filepath.Join(kubeconfigDir, "..prod.yaml"), "..prod.yaml"},                                       // not a parent dir
+		{true, "", ""},
+	} {
+		relativeSymlinks = c.relative
+		if got := symlinkTarget(c.path); got != c.want {
+			t.Errorf("symlinkTarget(%q) with relative symlinks %v = %q, want %q", c.path, c.relative, got, c.want)
+		}
+	}
+}
+
+func TestResolveSymlinkTarget(t *testing.T) {
+	outside := t.TempDir()
+	for _, c := range []struct {
+		target string
+		want   string
+	}{
+		{"prod.yaml", filepath.Join(kubeconfigDir, "prod.yaml")},
+		{filepath.Join("team", "prod.yaml"), filepath.Join(kubeconfigDir, "team", "prod.yaml")},
+		{filepath.Join("..", "prod.yaml"), filepath.Join(filepath.Dir(kubeconfigDir), "prod.yaml")},
+		{filepath.Join(outside, "prod.yaml"), filepath.Join(outside, "prod.yaml")},
+		{"", ""},
+	} {
+		if got := resolveSymlinkTarget(c.target); got != c.want {
+			t.Errorf("resolveSymlinkTarget(%q) = %q, want %q", c.target, got, c.want)
+		}
+	}
+}
+
+func TestReadCurrentKubeconfigPathRelative(t *testing.T) {
+	target := writeTestFile(t, filepath.Join(kubeconfigDir, "team"), "prod.yaml", "kind: Config\n")
+	t.Cleanup(func() { _ = os.RemoveAll(filepath.Dir(target)) })
+	resetKubeconfigSymlink(t, filepath.Join("team", "prod.yaml"))
+
+	if got, err := ReadCurrentKubeconfigPath(); err != nil || got != target {
+		t.Errorf("got %q, %v, want %s", got, err, target)
+	}
+}
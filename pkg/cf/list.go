@@ -0,0 +1,30 @@
+package cf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runList implements "cf list", which prints all candidates, and the sources which can not be read to stderr
+func runList(_ []string) error {
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	candidates, sourceErrors := ListKubeconfigCandidates(currentKubeconfigPath)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tCONTEXT\tSOURCE\tTAGS\tPATH")
+	for _, c := range candidates {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.DisplayName(), c.CurrentContext, displayPath(c.Source), strings.Join(c.Tags, ","), c.FullPath)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, sourceError := range sourceErrors {
+		_, _ = fmt.Fprintln(os.Stderr, warning(sourceError.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package cf
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// captureOutput returns what run writes to stdout and stderr
+func captureOutput(t *testing.T, run func() error) (string, string) {
+	t.Helper()
+	stdout, stderr := os.Stdout, os.Stderr
+	t.Cleanup(func() { os.Stdout, os.Stderr = stdout, stderr })
+
+	var outputs [2]string
+	var writers [2]*os.File
+	done := make(chan struct{}, 2)
+	for i := range outputs {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = w
+		go func() {
+			b, _ := io.ReadAll(r)
+			outputs[i] = string(b)
+			done <- struct{}{}
+		}()
+	}
+	os.Stdout, os.Stderr = writers[0], writers[1]
+	err := run()
+	os.Stdout, os.Stderr = stdout, stderr
+	for _, w := range writers {
+		_ = w.Close()
+	}
+	<-done
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outputs[0], outputs[1]
+}
+
+func TestListWithUnreadableSource(t *testing.T) {
+	path := writeTestFile(t, kubeconfigDir, "listed.yaml", "kind: Config\ncurrent-context: listed-admin\n")
+	t.Cleanup(func() { _ = os.Remove(path) })
+	resetKubeconfigSymlink(t, path)
+	unreadable := "http://127.0.0.1:1/catalog.json" // never requested, catalogs must be served over https
+	defer func(sources []Source) { kubeconfigSources = sources }(kubeconfigSources)
+	kubeconfigSources = []Source{{Path: KubeconfigSpecialPathKubeconfigDir}, {Path: unreadable}}
+
+	candidates, sourceErrors := ListKubeconfigCandidates(path)
+	if got := candidateNames(candidates); len(got) != 1 || got[0] != "listed.yaml" {
+		t.Errorf("got candidates %v, want the candidate of the readable source", got)
+	}
+	if len(sourceErrors) != 1 || sourceErrors[0].Source != unreadable {
+		t.Errorf("got source errors %v, want the error of %s", sourceErrors, unreadable)
+	}
+
+	stdout, stderr := captureOutput(t, func() error { return runList(nil) })
+	for _, want := range []string{"NAME", "listed.yaml", "listed-admin", path} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("%q not found in stdout:\n%s", want, stdout)
+		}
+	}
+	if !strings.Contains(stderr, unreadable) || strings.Contains(stdout, unreadable) {
+		t.Errorf("the unreadable source is not reported to stderr only:\nstdout: %s\nstderr: %s", stdout, stderr)
+	}
+
+	modal := &KubectlCfModal{
+		list:         list.New(candidates.ToListItems(), list.NewDefaultDelegate(), 200, 20),
+		candidates:   candidates,
+		sourceErrors: sourceErrors,
+		mode:         ModeSelect,
+		width:        400,
+	}
+	if view := modal.View(); !strings.Contains(view, "Unable to read 1 source(s)") {
+		t.Errorf("the banner of unreadable sources is not shown:\n%s", view)
+	}
+	if modal.headerHeight() != tabsHeight+1 {
+		t.Errorf("got header height %d, want the tabs and the banner", modal.headerHeight())
+	}
+}
@@ -0,0 +1,48 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestMain points all files of kubectl-cf at a temporary home, so tests never touch the real kubeconfig
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "kubectl-cf-test-")
+	if err != nil {
+		panic(err)
+	}
+
+	setConfigDir(filepath.Join(home, "kubectl-cf"))
+	kubeconfigDir = filepath.Join(home, "kube")
+	kubeconfigPath = filepath.Join(kubeconfigDir, "config")
+	for _, dir := range []string{kubectlCfConfigDir, kubeconfigDir} {
+		if err := os.MkdirAll(dir, ConfigDirMode); err != nil {
+			panic(err)
+		}
+	}
+	kubeconfigFilenameMatchPattern = regexp.MustCompile(KubeconfigFilenameMatchPatternStrDefault)
+	decryptFilenameMatchPattern = regexp.MustCompile(DecryptFilenameMatchPatternStrDefault)
+	config = &Config{}
+	_ = os.Setenv("XDG_RUNTIME_DIR", filepath.Join(home, "run"))
+	_ = os.Unsetenv("KUBECTL_CF_PASSPHRASE")
+	kubeconfigSources = []Source{{Path: KubeconfigSpecialPathKubeconfigDir}}
+
+	code := m.Run()
+	_ = os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// writeTestFile writes content to name under dir, creating parent directories, and returns the path
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
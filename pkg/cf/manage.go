@@ -0,0 +1,160 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+// isSamePath returns true if a and b are the same non-empty path after cleaning
+func isSamePath(a, b string) bool {
+	return a != "" && b != "" && filepath.Clean(a) == filepath.Clean(b)
+}
+
+// isCurrentKubeconfig returns true if the candidate is the current symlink target
+func (modal *KubectlCfModal) isCurrentKubeconfig(candidate Candidate) bool {
+	return isSamePath(candidate.FullPath, modal.currentKubeconfigPath)
+}
+
+// readPreviousKubeconfigPath returns the content of the previous file, empty if not exist
+func readPreviousKubeconfigPath() (string, error) {
+	f, err := os.ReadFile(previousKubeconfigConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "os.ReadFile error")
+	}
+	return string(f), nil
+}
+
+// renameCandidate renames the file of candidate to newName in the same directory,
+// the new name must still be listed by the source of the candidate, see Candidate.checkFileName.
+// If the previous file points to the renamed file, it will be updated as well.
+func (modal *KubectlCfModal) renameCandidate(candidate Candidate, newName string) (string, error) {
+	if modal.isCurrentKubeconfig(candidate) {
+		return "", errors.New(t("refuseToModifyCurrentKubeconfig"))
+	}
+	newName = strings.TrimSpace(newName)
+	if newName == "" || filepath.Base(newName) != newName {
+		return "", errors.New(t("invalidKubeconfigName", newName))
+	}
+	if isEncryptedPath(newName) != candidate.Encrypted {
+		return "", errors.New(t("renameChangesEncryption", EncryptedFileSuffix))
+	}
+	if err := candidate.checkFileName(newName); err != nil {
+		return "", err
+	}
+
+	newPath := filepath.Join(filepath.Dir(candidate.FullPath), newName)
+	if _, err := os.Lstat(newPath); err == nil {
+		return "", errors.New(t("fileAlreadyExists", newPath))
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "os.Lstat error")
+	}
+	o := beginOperation(t("renameDescription", candidate.FullPath, newPath))
+	defer o.Commit()
+	if err := o.Rename(candidate.FullPath, newPath); err != nil {
+		return "", err
+	}
+
+	previous, err := readPreviousKubeconfigPath()
+	if err != nil {
+		return "", err
+	}
+	if isSamePath(previous, candidate.FullPath) {
+		if err := o.WriteFile(previousKubeconfigConfigPath, &newPath, ConfigFileMode); err != nil {
+			return "", errors.Wrap(err, "update previous kubeconfig error")
+		}
+	}
+	return newPath, nil
+}
+
+// checkFileName returns an error if a file named fileName in the directory of candidate would not be listed
+// by the source of candidate, since it is excluded or does not match the pattern (EncryptedFileSuffix excluded)
+// nor decryptFilenameMatchPattern, so a renamed file or a copy would disappear from the list.
+// The pattern is not checked for sources detecting kubeconfig files by content only.
+func (c Candidate) checkFileName(fileName string) error {
+	if c.Origin.scansDirs() && c.Origin.Path != "" {
+		var rel string
+		root, err := filepath.Abs(c.Origin.Path)
+		if err == nil {
+			rel, err = filepath.Rel(root, filepath.Join(filepath.Dir(c.FullPath), fileName))
+		}
+		if err == nil && c.Origin.excluded(filepath.ToSlash(rel), false) {
+			return errors.New(t("nameExcluded", fileName))
+		}
+	}
+	if c.Origin.Detect == DetectContent || isExternallyEncryptedPath(fileName) {
+		return nil
+	}
+	if pattern := c.Origin.matchPattern(); !pattern.MatchString(strings.TrimSuffix(fileName, EncryptedFileSuffix)) {
+		return errors.New(t("nameNotMatchPattern", fileName, pattern.String()))
+	}
+	return nil
+}
+
+// duplicatePathSuggestion generates a path for the copy of candidate, which is listed by the source of candidate,
+// for example, prod.yaml will be copied to prod-copy.yaml, prod-copy-1.yaml, ...,
+// or copy-prod.yaml if the pattern of the source does not accept the former, and so on
+func duplicatePathSuggestion(candidate Candidate) (string, error) {
+	dir, base := filepath.Split(candidate.FullPath)
+	encryptedSuffix := ""
+	if strings.HasSuffix(base, EncryptedFileSuffix) {
+		encryptedSuffix, base = EncryptedFileSuffix, strings.TrimSuffix(base, EncryptedFileSuffix)
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	var err error
+	for _, suggestion := range [][2]string{
+		{stem + "-copy", ext},
+		{stem + "_copy", ext},
+		{"copy-" + stem, ext},
+		{"copy_" + stem, ext},
+		{stem + "-copy", ext + ".yaml"}, // like config-copy.yaml for config
+	} {
+		var path string
+		if path, err = sys.GenerateBackUpName(filepath.Join(dir, suggestion[0]), suggestion[1]+encryptedSuffix); err != nil {
+			return "", err
+		}
+		if err = candidate.checkFileName(filepath.Base(path)); err == nil {
+			return path, nil
+		}
+	}
+	return "", err
+}
+
+// duplicateCandidate copies the file of candidate to dst
+func duplicateCandidate(candidate Candidate, dst string) error {
+	o := beginOperation(t("duplicateDescription", candidate.FullPath, dst))
+	defer o.Commit()
+	return o.Create(candidate.FullPath, dst)
+}
+
+// deleteCandidate moves the file of candidate to the trash dir, returns the path in trash dir.
+// If the previous file points to the deleted file, it will be cleared.
+func (modal *KubectlCfModal) deleteCandidate(candidate Candidate) (string, error) {
+	if modal.isCurrentKubeconfig(candidate) {
+		return "", errors.New(t("refuseToModifyCurrentKubeconfig"))
+	}
+	o := beginOperation(t("deleteDescription", candidate.FullPath))
+	defer o.Commit()
+	trashPath, err := o.MoveToTrash(candidate.FullPath)
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := readPreviousKubeconfigPath()
+	if err != nil {
+		return "", err
+	}
+	if isSamePath(previous, candidate.FullPath) {
+		if err := o.WriteFile(previousKubeconfigConfigPath, nil, ConfigFileMode); err != nil {
+			return "", errors.Wrap(err, "remove previous kubeconfig error")
+		}
+	}
+	return trashPath, nil
+}
@@ -0,0 +1,127 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckFileName(t *testing.T) {
+	root := t.TempDir()
+	vendor := Source{Path: root, Detect: DetectPattern, Pattern: `^(?P<name>.+)\.kubeconfig$`, Exclude: []string{"*.bak.kubeconfig"}}
+	if err := vendor.compile(); err != nil {
+		t.Fatal(err)
+	}
+	content := Source{Path: root, Detect: DetectContent}
+
+	for _, c := range []struct {
+		origin   Source
+		fileName string
+		ok       bool
+	}{
+		{Source{Path: root, Detect: DetectPattern}, "prod.yaml", true},
+		{Source{Path: root, Detect: DetectPattern}, "prod.kubeconfig", false},
+		{Source{Path: root, Detect: DetectPattern}, "prod.enc.yaml", true}, // decrypted by the decrypt command
+		{vendor, "prod.kubeconfig", true},
+		{vendor, "prod.yaml", false},
+		{vendor, "prod.bak.kubeconfig", false}, // excluded
+		{content, "prod.conf", true},
+		{content, "cache", true},
+	} {
+		candidate := Candidate{FullPath: filepath.Join(root, "team", "old"), Origin: c.origin}
+		if err := candidate.checkFileName(c.fileName); (err == nil) != c.ok {
+			t.Errorf("checkFileName(%q) with pattern %s: got %v, want ok %v", c.fileName, c.origin.Pattern, err, c.ok)
+		}
+	}
+}
+
+func TestDuplicatePathSuggestion(t *testing.T) {
+	root := t.TempDir()
+	vendor := Source{Path: root, Detect: DetectPattern, Pattern: `^[a-z]+\.kubeconfig$`}
+	if err := vendor.compile(); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, root, "prod-copy.yaml", "")
+
+	for _, c := range []struct {
+		origin Source
+		file   string
+		want   string
+	}{
+		{Source{Path: root, Detect: DetectPattern}, "prod.yaml", "prod-copy-1.yaml"},
+		{Source{Path: root, Detect: DetectPattern}, "config", "config-copy.yaml"},
+		{Source{Path: root, Detect: DetectPattern}, "prod.yaml" + EncryptedFileSuffix, "prod-copy.yaml" + EncryptedFileSuffix},
+		{vendor, "prod.kubeconfig", ""}, // no suggestion matches the pattern
+		{Source{Path: root, Detect: DetectContent}, "prod.conf", "prod-copy.conf"},
+	} {
+		got, err := duplicatePathSuggestion(Candidate{FullPath: filepath.Join(root, c.file), Origin: c.origin})
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("duplicatePathSuggestion(%s): got %s, want an error", c.file, got)
+			}
+			continue
+		}
+		if err != nil || got != filepath.Join(root, c.want) {
+			t.Errorf("duplicatePathSuggestion(%s): got %s, %v, want %s", c.file, got, err, c.want)
+		}
+	}
+}
+
+func TestRenameAndDeleteCandidate(t *testing.T) {
+	source := Source{Path: t.TempDir(), Detect: DetectPattern}
+	tests := []struct {
+		name     string
+		current  bool
+		previous bool
+		rename   bool
+		wantErr  bool
+	}{
+		{name: "rename current", current: true, rename: true, wantErr: true},
+		{name: "delete current", current: true, wantErr: true},
+		{name: "rename", rename: true},
+		{name: "delete"},
+		{name: "rename previous", previous: true, rename: true},
+		{name: "delete previous", previous: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, source.Path, "a.yaml", "a")
+			t.Cleanup(func() { _ = os.Remove(filepath.Join(source.Path, "b.yaml")) })
+			candidate := Candidate{Name: "a", FullPath: path, Origin: source}
+			modal := &KubectlCfModal{}
+			if tt.current {
+				modal.currentKubeconfigPath = path
+			}
+			if tt.previous {
+				if err := os.WriteFile(previousKubeconfigConfigPath, []byte(path), ConfigFileMode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Cleanup(func() { _ = os.Remove(previousKubeconfigConfigPath) })
+
+			var newPath string
+			var err error
+			if tt.rename {
+				newPath, err = modal.renameCandidate(candidate, "b.yaml")
+			} else {
+				_, err = modal.deleteCandidate(candidate)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(path); os.IsNotExist(statErr) == tt.wantErr {
+				t.Errorf("file exists %v after refusal %v", statErr == nil, tt.wantErr)
+			}
+			if !tt.previous {
+				return
+			}
+			previous, err := readPreviousKubeconfigPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if previous != newPath { // the previous file is cleared if the file is deleted
+				t.Errorf("previous is %q, want %q", previous, newPath)
+			}
+		})
+	}
+}
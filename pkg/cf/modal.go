@@ -6,9 +6,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/junchaw/kubectl-cf/pkg/sys"
@@ -19,6 +22,13 @@ const (
 
 	ModeSelect = iota
 	ModeAskIfRenameKubeconfig
+	ModeRename
+	ModeConfirmDuplicate
+	ModeConfirmDelete
+	ModeDiff
+	ModeRepair
+	ModePassphrase
+	ModeSwitching
 	ModeQuit
 )
 
@@ -37,6 +47,82 @@ type KubectlCfModal struct {
 	// used in mode: ModeAskIfRenameKubeconfig
 	kubeconfigPathSuggestion string
 
+	// operand is the candidate being renamed, duplicated or deleted,
+	// used in modes: ModeRename, ModeConfirmDuplicate, ModeConfirmDelete
+	operand Candidate
+
+	// nameInput is the input for the new name of operand,
+	// used in mode: ModeRename
+	nameInput textinput.Model
+
+	// duplicatePath is the path which operand will be copied to,
+	// used in mode: ModeConfirmDuplicate
+	duplicatePath string
+
+	// diffBase is the candidate marked as the base of diff, empty if not marked
+	diffBase Candidate
+
+	// diffView shows the diff between diffBase and the selected candidate,
+	// used in mode: ModeDiff
+	diffView viewport.Model
+
+	// repairSuggestion is the candidate whose name is the closest to the missing symlink target,
+	// repairPrevious is the previous kubeconfig, both could be empty,
+	// used in mode: ModeRepair
+	repairSuggestion string
+	repairPrevious   string
+
+	// switchTarget is the encrypted kubeconfig to switch to once the passphrase is entered,
+	// or the kubeconfig to switch to once its runtime target is ready,
+	// passphraseInput is the input for the passphrase,
+	// used in modes: ModePassphrase, ModeSwitching
+	switchTarget    string
+	passphraseInput textinput.Model
+
+	// guessArg is the kubeconfig name given as the argument, guessed once all sources are scanned, see switchToGuess,
+	// used in mode: ModeSwitching
+	guessArg string
+
+	// passphrase decrypts encrypted kubeconfig files, empty if not entered
+	passphrase string
+
+	// width and height are the size of the window
+	width, height int
+
+	// showPreview controls whether the preview pane of the selected candidate is shown,
+	// used in mode: ModeSelect
+	showPreview bool
+
+	// groupBy is the group-by mode of the list, like GroupBySource,
+	// groupIndex and groupName identify the selected group,
+	// used in mode: ModeSelect
+	groupBy    int
+	groupIndex int
+	groupName  string
+
+	// sortMode is the sort mode of the list, like SortByName
+	sortMode string
+
+	// sourceErrors are the sources which can not be read when candidates were listed
+	sourceErrors []SourceError
+
+	// scans are the last results of kubeconfigSources, nil if never scanned,
+	// scanPending marks the sources being scanned in the background,
+	// scanGeneration tells the results of the latest scan from outdated ones, see startScan
+	scans          []*sourceScan
+	scanPending    []bool
+	scanGeneration int
+
+	// focusPath is the candidate to highlight once it is found by the background scan
+	focusPath string
+
+	// watcher watches watchedDirs, the directories of scans, nil if not watching, see watchSources
+	watcher     *sys.Watcher
+	watchedDirs []string
+
+	// previewCache caches the rendered previews by candidate full path, reset on refresh
+	previewCache map[string]string
+
 	// farewell is the message which will be printed before quitting
 	// used in mode: ModeQuit
 	farewell string
@@ -53,51 +139,47 @@ func (modal *KubectlCfModal) quit(farewell string) tea.Cmd {
 	return tea.Quit
 }
 
+// symlinkConfigPathTo points the kubeconfig symlink to name,
+// an encrypted kubeconfig is decrypted into a runtime file which the symlink points to instead,
+// and the runtime file of the replaced kubeconfig is wiped,
+// an externally encrypted kubeconfig is decrypted by the decrypt command into a cache file,
+// and a kubeconfig provided on demand by an exec source is fetched into a runtime file.
+// It blocks until the runtime target is ready, the program switches by startSwitch instead.
 func (modal *KubectlCfModal) symlinkConfigPathTo(name string) string {
-	if err := os.WriteFile(previousKubeconfigConfigPath, []byte(modal.currentKubeconfigPath), 0644); err != nil {
+	target, err := runtimeTargetOf(name, modal.passphrase)
+	if err != nil {
+		return warning(err.Error())
+	}
+	return modal.symlinkConfigPathToTarget(name, target)
+}
+
+// symlinkConfigPathToTarget points the kubeconfig symlink to target, the runtime target of name, see runtimeTargetOf
+func (modal *KubectlCfModal) symlinkConfigPathToTarget(name, target string) string {
+	replaced, _ := os.Readlink(kubeconfigPath)
+
+	o := beginOperation(t("switchDescription", name))
+	defer o.Commit()
+	if err := o.WriteFile(previousKubeconfigConfigPath, &modal.currentKubeconfigPath, ConfigFileMode); err != nil {
 		return warning(t("updatePreviousKubeconfigError", err.Error()))
 	}
-	if err := sys.CreateSymlink(name, kubeconfigPath); err != nil {
+	if err := o.CreateSymlink(symlinkTarget(target), kubeconfigPath); err != nil {
 		return warning(t("createSymlinkError", err.Error()))
 	}
+	wipeReplacedRuntimeFile(replaced, target)
+	sweepExpiredCacheFiles(target)
+	recordUsage(name)
 	return text(t("symlinkNowPointTo", info(kubeconfigPath), info(name)))
 }
 
-func (modal *KubectlCfModal) refreshCandidates() error {
-	var candidates Candidates
-	for _, kubeconfigDirPath := range kubeconfigDirPaths {
-		if kubeconfigDirPath == KubeconfigSpecialPathKubeconfigDir { // parse special path for kubeconfig dir
-			kubeconfigDirPath = filepath.Dir(modal.currentKubeconfigPath)
-		}
-		candidatesInDir, err := ListKubeconfigCandidatesInDir(kubeconfigDirPath)
-		if err != nil {
-			return err
-		}
-		for _, candidate := range candidatesInDir {
-			if candidate.FullPath != kubeconfigPath { // filter out the current kubeconfig
-				candidates = append(candidates, candidate)
-			}
-		}
-	}
-	modal.candidates = candidates
-	modal.list.SetItems(candidates.ToListItems())
-	return nil
-}
-
-func (modal *KubectlCfModal) focusOnCurrentKubeconfig() {
-	for index, candidate := range modal.candidates {
-		if candidate.FullPath == modal.currentKubeconfigPath {
+// focusOn selects the candidate at path in the list, returns false if it is not in the list
+func (modal *KubectlCfModal) focusOn(path string) bool {
+	for index, item := range modal.list.Items() {
+		if item.(Candidate).FullPath == path {
 			modal.list.Select(index)
+			return true
 		}
 	}
-}
-
-func (modal *KubectlCfModal) refreshCandidatesAndFocusOnCurrentKubeconfig() error {
-	if err := modal.refreshCandidates(); err != nil {
-		return err
-	}
-	modal.focusOnCurrentKubeconfig()
-	return nil
+	return false
 }
 
 func (modal *KubectlCfModal) Init() tea.Cmd {
@@ -109,21 +191,44 @@ func (modal *KubectlCfModal) Init() tea.Cmd {
 	list := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0) // will set later
 	list.Title = t("whatKubeconfig")
 	list.SetShowPagination(true)
+	list.StatusMessageLifetime = 5 * time.Second
 	list.AdditionalShortHelpKeys = func() []key.Binding {
 		return []key.Binding{
 			key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "select")),
 		}
 	}
+	list.AdditionalFullHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "rename")),
+			key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "duplicate")),
+			key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "delete")),
+			key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+			key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "toggle preview")),
+			key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "mark for diff")),
+			key.NewBinding(key.WithKeys("D"), key.WithHelp("D", "diff with marked")),
+			key.NewBinding(key.WithKeys("left", "right"), key.WithHelp("←/→", "switch group")),
+			key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "change group by")),
+			key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "change sort")),
+			key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "reload")),
+		}
+	}
+	// left and right switch groups instead of pages
+	list.KeyMap.PrevPage = key.NewBinding(key.WithKeys("h", "pgup", "b", "u"), key.WithHelp("h/pgup", "prev page"))
+	list.KeyMap.NextPage = key.NewBinding(key.WithKeys("l", "pgdown", "f", "d"), key.WithHelp("l/pgdn", "next page"))
 	modal.list = list
+	modal.showPreview = true
+	modal.sortMode = defaultSortMode
 
 	info, err := os.Lstat(kubeconfigPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			panic(err)
 		}
-		if err := sys.CreateSymlink("", kubeconfigPath); err != nil {
+		o := beginOperation(t("createEmptySymlinkDescription", kubeconfigPath))
+		if err := o.CreateSymlink("", kubeconfigPath); err != nil {
 			panic(err)
 		}
+		o.Commit()
 		modal.mode = ModeSelect
 		logger.Infof("The kubeconfig not exist, created an empty symlink: %s", kubeconfigPath)
 	} else {
@@ -133,7 +238,7 @@ func (modal *KubectlCfModal) Init() tea.Cmd {
 				panic(err)
 			}
 			modal.mode = ModeSelect
-			modal.currentKubeconfigPath = target
+			modal.currentKubeconfigPath = sourceOfRuntimeFile(resolveSymlinkTarget(target))
 		} else {
 			logger.Infof("The kubeconfig is not a symlink, need to ask user for confirmation")
 			kubeconfigPathSuggestion, err := sys.GenerateBackUpName(filepath.Join(kubeconfigDir, DefaultKubeconfigBaseName), ".yaml")
@@ -147,60 +252,73 @@ func (modal *KubectlCfModal) Init() tea.Cmd {
 		}
 	}
 
-	if err := modal.refreshCandidatesAndFocusOnCurrentKubeconfig(); err != nil {
-		return modal.quit(warning(t("unableToRefreshCandidates", err.Error())))
+	if kubeconfigArg == "" && modal.isDangling() {
+		logger.Infof("The kubeconfig symlink target %s not exist, need to repair", modal.currentKubeconfigPath)
+		modal.startRepair() // the closest match is suggested once it is found by the scan
+		return modal.startScan(modal.currentKubeconfigPath)
 	}
 
-	if kubeconfigArg != "" {
-		if kubeconfigArg == "-" {
-			f, err := os.ReadFile(previousKubeconfigConfigPath)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					panic(err)
-				}
-				return modal.quit(warning(t("noPreviousKubeconfig")))
-			}
-			return modal.quit(modal.symlinkConfigPathTo(string(f)))
-		}
+	if kubeconfigArg == "" {
+		return modal.startScan(modal.currentKubeconfigPath)
+	}
 
-		var guessCandidates []Candidate
-		for _, candidate := range modal.candidates {
-			if candidate.Name == kubeconfigArg {
-				guessCandidates = []Candidate{candidate}
-				break
-			}
-			if strings.HasPrefix(candidate.Name, kubeconfigArg) { // guess candidates by prefix
-				guessCandidates = append(guessCandidates, candidate)
+	if kubeconfigArg == "-" {
+		f, err := os.ReadFile(previousKubeconfigConfigPath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				panic(err)
 			}
+			return modal.quit(warning(t("noPreviousKubeconfig")))
 		}
+		return modal.switchTo(string(f))
+	}
 
-		if guessCandidates == nil {
-			return modal.quit(warning(t("noMatchFound", kubeconfigArg)))
-		}
+	modal.mode = ModeSwitching
+	modal.switchTarget = kubeconfigArg
+	modal.guessArg = kubeconfigArg
+	return modal.startScan("") // switchToGuess once all sources are scanned
+}
 
-		if len(guessCandidates) == 1 { // if there is only one guess candidate, use it
-			return modal.quit(modal.symlinkConfigPathTo(guessCandidates[0].FullPath))
-		}
+// switchToGuess switches to the only candidate guessed from guessArg, or quits if there is none or more than one
+func (modal *KubectlCfModal) switchToGuess() tea.Cmd {
+	kubeconfigArg := modal.guessArg
+	modal.guessArg = ""
+	guessCandidates := modal.candidates.Guess(kubeconfigArg)
+	if guessCandidates == nil {
+		return modal.quit(warning(t("noMatchFound", kubeconfigArg)))
+	}
 
-		var names []string // if there are multiple guess candidates, show the names
-		for _, g := range guessCandidates {
-			names = append(names, g.Name)
-		}
-		return modal.quit(warning(t("moreThanOneMatchesFound", kubeconfigArg, strings.Join(names, ", "))))
+	if len(guessCandidates) == 1 { // if there is only one guess candidate, use it
+		return modal.switchTo(guessCandidates[0].FullPath)
 	}
 
-	return nil
+	var names []string // if there are multiple guess candidates, show the names
+	for _, g := range guessCandidates {
+		names = append(names, g.DisplayName())
+	}
+	return modal.quit(warning(t("moreThanOneMatchesFound", kubeconfigArg, strings.Join(names, ", "))))
 }
 
 func (modal *KubectlCfModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg: // Is it a key press?
 		switch msg.String() { // The key pressed
-		case "ctrl+c", "q", "esc": // These keys should exit the program.
+		case "ctrl+c": // This key should always exit the program.
 			return modal, tea.Quit
+		case "q", "esc": // These keys should exit the program, unless the modal is capturing keys.
+			if !modal.capturingKeys() {
+				return modal, tea.Quit
+			}
 		}
 	}
 
+	switch msg := msg.(type) {
+	case sourceScannedMsg, sourceTimeoutMsg: // sources are scanned in the background in any mode
+		return modal, modal.updateScan(msg)
+	case filesChangedMsg:
+		return modal, modal.handleFilesChanged(msg)
+	}
+
 	switch modal.mode {
 
 	case ModeQuit:
@@ -211,18 +329,17 @@ func (modal *KubectlCfModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyMsg: // Is it a key press?
 			switch msg.String() { // The key pressed
 			case "y", "Y":
-				if err := os.Rename(kubeconfigPath, modal.kubeconfigPathSuggestion); err != nil {
+				o := beginOperation(t("takeControlDescription", kubeconfigPath))
+				defer o.Commit()
+				if err := o.Rename(kubeconfigPath, modal.kubeconfigPathSuggestion); err != nil {
 					return modal, modal.quit(warning(t("renameKubeconfigError", err.Error())))
 				}
-				if err := sys.CreateSymlink(modal.kubeconfigPathSuggestion, kubeconfigPath); err != nil {
+				if err := o.CreateSymlink(symlinkTarget(modal.kubeconfigPathSuggestion), kubeconfigPath); err != nil {
 					return modal, modal.quit(warning(t("createSymlinkError", err.Error())))
 				}
 				modal.currentKubeconfigPath = modal.kubeconfigPathSuggestion
-				if err := modal.refreshCandidatesAndFocusOnCurrentKubeconfig(); err != nil {
-					return modal, modal.quit(warning(t("unableToRefreshCandidates", err.Error())))
-				}
 				modal.mode = ModeSelect
-				return modal, nil
+				return modal, modal.startScan(modal.currentKubeconfigPath)
 			case "n", "N":
 				return modal, modal.quit(t("renameKubeconfigCanceled"))
 			}
@@ -232,12 +349,63 @@ func (modal *KubectlCfModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ModeSelect:
 		switch msg := msg.(type) {
 		case tea.WindowSizeMsg:
-			h, v := docStyle.GetFrameSize()
-			modal.list.SetSize(msg.Width-h, msg.Height-v)
+			modal.width, modal.height = msg.Width, msg.Height
+			modal.layout()
+		case editorFinishedMsg:
+			return modal, modal.handleEditorFinished(msg)
 		case tea.KeyMsg: // Is it a key press?
+			if modal.list.SettingFilter() && msg.String() != "enter" {
+				break // let the list handle the filter input
+			}
 			switch msg.String() { // The key pressed
 			case "enter": // The "enter" key selects the current candidate
-				return modal, modal.quit(modal.symlinkConfigPathTo(modal.list.SelectedItem().(Candidate).FullPath))
+				candidate, ok := modal.list.SelectedItem().(Candidate)
+				if !ok { // no candidates found yet
+					return modal, nil
+				}
+				return modal, modal.switchTo(candidate.FullPath)
+			case "r", "c", "x":
+				if cmd, ok := modal.startManaging(msg.String()); ok {
+					return modal, cmd
+				}
+			case "e":
+				if candidate, ok := modal.list.SelectedItem().(Candidate); ok {
+					if isExecPath(candidate.FullPath) {
+						return modal, modal.list.NewStatusMessage(warning(t("providedOnDemand", candidate.DisplayName(), candidate.Source)))
+					}
+					if isCatalogFile(candidate.FullPath) {
+						return modal, modal.list.NewStatusMessage(warning(t("refuseToModifyCatalogKubeconfig")))
+					}
+					if isExternallyEncryptedPath(candidate.FullPath) {
+						return modal, modal.list.NewStatusMessage(warning(t("refuseToEditExternallyEncryptedKubeconfig")))
+					}
+					if candidate.Encrypted {
+						return modal, modal.list.NewStatusMessage(warning(t("refuseToEditEncryptedKubeconfig")))
+					}
+					return modal, editCandidate(candidate)
+				}
+			case "p":
+				modal.showPreview = !modal.showPreview
+				modal.layout()
+				return modal, nil
+			case "left":
+				modal.switchGroup(-1)
+				return modal, nil
+			case "right":
+				modal.switchGroup(1)
+				return modal, nil
+			case "tab":
+				modal.cycleGroupBy()
+				return modal, nil
+			case "s":
+				modal.cycleSortMode()
+				return modal, nil
+			case "ctrl+r":
+				return modal, tea.Batch(modal.startScan(""), modal.list.NewStatusMessage(text(t("reloading"))))
+			case "m":
+				return modal, modal.markDiffBase()
+			case "D":
+				return modal, modal.showDiff()
 			}
 		}
 
@@ -246,21 +414,198 @@ func (modal *KubectlCfModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		return modal, cmd
 
+	case ModeRename:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "enter":
+				newPath, err := modal.renameCandidate(modal.operand, modal.nameInput.Value())
+				if err != nil {
+					return modal, modal.backToSelect(warning(err.Error()))
+				}
+				return modal, modal.backToSelect(text(t("renamedKubeconfig", info(modal.operand.FullPath), info(newPath))))
+			case "esc":
+				return modal, modal.backToSelect("")
+			}
+		}
+		var cmd tea.Cmd
+		modal.nameInput, cmd = modal.nameInput.Update(msg)
+		return modal, cmd
+
+	case ModeConfirmDuplicate:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "y", "Y", "enter":
+				if err := duplicateCandidate(modal.operand, modal.duplicatePath); err != nil {
+					return modal, modal.backToSelect(warning(t("duplicateKubeconfigError", err.Error())))
+				}
+				return modal, modal.backToSelect(text(t("duplicatedKubeconfig", info(modal.operand.FullPath), info(modal.duplicatePath))))
+			case "n", "N", "esc":
+				return modal, modal.backToSelect("")
+			}
+		}
+		return modal, nil
+
+	case ModeConfirmDelete:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "y", "Y":
+				trashPath, err := modal.deleteCandidate(modal.operand)
+				if err != nil {
+					return modal, modal.backToSelect(warning(t("deleteKubeconfigError", err.Error())))
+				}
+				return modal, modal.backToSelect(text(t("movedKubeconfigToTrash", info(modal.operand.FullPath), info(trashPath))))
+			case "n", "N", "esc", "enter":
+				return modal, modal.backToSelect("")
+			}
+		}
+		return modal, nil
+
+	case ModeRepair:
+		if msg, ok := msg.(tea.WindowSizeMsg); ok {
+			modal.width, modal.height = msg.Width, msg.Height
+			modal.layout()
+		}
+		return modal, modal.updateRepair(msg)
+
+	case ModePassphrase:
+		if msg, ok := msg.(tea.WindowSizeMsg); ok {
+			modal.width, modal.height = msg.Width, msg.Height
+			modal.layout()
+		}
+		return modal, modal.updatePassphrase(msg)
+
+	case ModeSwitching:
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			modal.width, modal.height = msg.Width, msg.Height
+			modal.layout()
+		case runtimeTargetMsg:
+			return modal, modal.finishSwitch(msg)
+		}
+		return modal, nil
+
+	case ModeDiff:
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			modal.width, modal.height = msg.Width, msg.Height
+			modal.layout()
+			h, v := docStyle.GetFrameSize()
+			modal.diffView.Width, modal.diffView.Height = msg.Width-h, msg.Height-v
+		case tea.KeyMsg:
+			switch msg.String() {
+			case "q", "esc", "enter":
+				modal.mode = ModeSelect
+				return modal, nil
+			}
+		}
+		var cmd tea.Cmd
+		modal.diffView, cmd = modal.diffView.Update(msg)
+		return modal, cmd
+
 	default:
 		return modal, nil
 	}
 }
 
+// capturingKeys returns true if keys should be handled by the current mode rather than quitting the program
+func (modal *KubectlCfModal) capturingKeys() bool {
+	switch modal.mode {
+	case ModeRename, ModeConfirmDuplicate, ModeConfirmDelete, ModeDiff, ModeRepair, ModePassphrase:
+		return true
+	case ModeSelect:
+		return modal.list.SettingFilter()
+	default:
+		return false
+	}
+}
+
+// startManaging enters the mode for the operation bound to key on the selected candidate
+func (modal *KubectlCfModal) startManaging(key string) (tea.Cmd, bool) {
+	candidate, ok := modal.list.SelectedItem().(Candidate)
+	if !ok {
+		return nil, false
+	}
+	if isExecPath(candidate.FullPath) {
+		return modal.list.NewStatusMessage(warning(t("providedOnDemand", candidate.DisplayName(), candidate.Source))), true
+	}
+	if isCatalogFile(candidate.FullPath) {
+		return modal.list.NewStatusMessage(warning(t("refuseToModifyCatalogKubeconfig"))), true
+	}
+	if key != "c" && modal.isCurrentKubeconfig(candidate) {
+		return modal.list.NewStatusMessage(warning(t("refuseToModifyCurrentKubeconfig"))), true
+	}
+	modal.operand = candidate
+
+	switch key {
+	case "r":
+		modal.nameInput = textinput.New()
+		modal.nameInput.Prompt = t("newNamePrompt")
+		modal.nameInput.SetValue(filepath.Base(candidate.FullPath))
+		modal.mode = ModeRename
+		return modal.nameInput.Focus(), true
+	case "c":
+		duplicatePath, err := duplicatePathSuggestion(candidate)
+		if err != nil {
+			return modal.list.NewStatusMessage(warning(t("duplicateKubeconfigError", err.Error()))), true
+		}
+		modal.duplicatePath = duplicatePath
+		modal.mode = ModeConfirmDuplicate
+		return nil, true
+	case "x":
+		modal.mode = ModeConfirmDelete
+		return nil, true
+	}
+	return nil, false
+}
+
+// backToSelect refreshes candidates and goes back to ModeSelect, showing status in the list if not empty
+func (modal *KubectlCfModal) backToSelect(status string) tea.Cmd {
+	modal.mode = ModeSelect
+	scan := modal.startScan(modal.currentKubeconfigPath)
+	if status == "" {
+		return scan
+	}
+	return tea.Batch(scan, modal.list.NewStatusMessage(status))
+}
+
 func (modal *KubectlCfModal) View() string {
 	switch modal.mode {
 	case ModeAskIfRenameKubeconfig:
 		return fmt.Sprint(t("notASymlinkDoYouWantToMoveIt", info(kubeconfigPath), info(modal.kubeconfigPathSuggestion)))
 
+	case ModeRename:
+		return fmt.Sprintf("%s\n\n%s\n", t("renameKubeconfig", info(modal.operand.FullPath)), modal.nameInput.View())
+
+	case ModeConfirmDuplicate:
+		return t("doYouWantToDuplicate", info(modal.operand.FullPath), info(modal.duplicatePath))
+
+	case ModeConfirmDelete:
+		return t("doYouWantToDelete", info(modal.operand.FullPath), info(trashDirPath))
+
+	case ModeDiff:
+		return docStyle.Render(modal.diffView.View())
+
+	case ModeRepair:
+		return modal.viewRepair()
+
+	case ModePassphrase:
+		return fmt.Sprintf("%s\n\n%s\n", t("decryptKubeconfig", info(modal.switchTarget)), modal.passphraseInput.View())
+
+	case ModeSwitching:
+		return fmt.Sprintf("%s\n", t("switchingTo", info(modal.switchTarget)))
+
 	case ModeQuit:
 		return modal.farewell
 
 	case ModeSelect:
-		return modal.list.View()
+		view := modal.list.View()
+		if modal.showPreview {
+			view = modal.viewWithPreview()
+		}
+		if len(modal.sourceErrors) > 0 {
+			return lipgloss.JoinVertical(lipgloss.Left, modal.viewSourceErrors(), modal.viewTabs(), view)
+		}
+		return lipgloss.JoinVertical(lipgloss.Left, modal.viewTabs(), view)
 
 	default:
 		return ""
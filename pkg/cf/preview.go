@@ -0,0 +1,159 @@
+package cf
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// previewSideBySideMinWidth is the minimal window width to render the preview pane beside the list,
+	// in narrower windows, the preview pane is rendered below the list
+	previewSideBySideMinWidth = 100
+
+	// redacted replaces secrets in the preview pane
+	redacted = "<redacted>"
+)
+
+var previewStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	BorderForeground(lipgloss.Color("240")).
+	Padding(0, 1)
+
+// previewSideBySide returns true if the preview pane should be rendered beside the list
+func (modal *KubectlCfModal) previewSideBySide() bool {
+	return modal.width >= previewSideBySideMinWidth
+}
+
+// layout resizes the list according to the window size and whether the preview pane is shown
+func (modal *KubectlCfModal) layout() {
+	h, v := docStyle.GetFrameSize()
+	width, height := modal.width-h, modal.height-v-modal.headerHeight()
+	if modal.showPreview {
+		if modal.previewSideBySide() {
+			width /= 2
+		} else {
+			height /= 2
+		}
+	}
+	modal.list.SetSize(width, height)
+}
+
+// preview returns the preview of candidate, cached until candidates are refreshed
+func (modal *KubectlCfModal) preview(candidate Candidate) string {
+	if p, ok := modal.previewCache[candidate.FullPath]; ok {
+		return p
+	}
+	if modal.previewCache == nil {
+		modal.previewCache = map[string]string{}
+	}
+	p := renderPreview(candidate)
+	modal.previewCache[candidate.FullPath] = p
+	return p
+}
+
+// renderPreview describes contexts, clusters, users and namespaces in the kubeconfig of candidate,
+// all secrets are redacted
+func renderPreview(candidate Candidate) string {
+	if isExecPath(candidate.FullPath) { // never fetched until switching to it
+		return text(t("providedOnDemand", info(candidate.DisplayName()), candidate.Source))
+	}
+	kubeconfig, err := ParseKubeconfigFile(candidate.FullPath)
+	if err != nil {
+		return warning(t("unableToPreviewKubeconfig", err.Error()))
+	}
+
+	var b strings.Builder
+	if len(candidate.Warnings) > 0 {
+		fmt.Fprintf(&b, "%s\n", t("previewWarnings"))
+		for _, w := range candidate.Warnings {
+			fmt.Fprintf(&b, "  %s\n", warning(w))
+		}
+		fmt.Fprintf(&b, "  %s\n\n", t("previewRunHarden"))
+	}
+	fmt.Fprintf(&b, "%s %s\n", t("previewCurrentContext"), info(kubeconfig.CurrentContext))
+
+	fmt.Fprintf(&b, "\n%s\n", t("previewContexts"))
+	for _, c := range kubeconfig.Contexts {
+		marker := " "
+		if c.Name == kubeconfig.CurrentContext {
+			marker = "*"
+		}
+		namespace := c.Context.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		fmt.Fprintf(&b, "%s %s\n", marker, info(c.Name))
+		fmt.Fprintf(&b, "    cluster: %s, user: %s, namespace: %s\n", c.Context.Cluster, c.Context.User, namespace)
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", t("previewClusters"))
+	for _, c := range kubeconfig.Clusters {
+		fmt.Fprintf(&b, "  %s\n", info(c.Name))
+		fmt.Fprintf(&b, "    server: %s\n", redactURL(c.Cluster.Server))
+		if c.Cluster.ProxyURL != "" {
+			fmt.Fprintf(&b, "    proxy-url: %s\n", redactURL(c.Cluster.ProxyURL))
+		}
+		if c.Cluster.InsecureSkipTLSVerify {
+			fmt.Fprintf(&b, "    %s\n", warning("insecure-skip-tls-verify: true"))
+		}
+		if c.Cluster.CertificateAuthorityData != "" {
+			fmt.Fprintf(&b, "    certificate-authority-data: %s\n", redacted)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", t("previewUsers"))
+	for _, u := range kubeconfig.Users {
+		fmt.Fprintf(&b, "  %s\n", info(u.Name))
+		fmt.Fprintf(&b, "    auth: %s\n", u.User.AuthMethod())
+		if u.User.Token != "" {
+			fmt.Fprintf(&b, "    token: %s\n", redacted)
+		}
+		if u.User.ClientKeyData != "" {
+			fmt.Fprintf(&b, "    client-key-data: %s\n", redacted)
+		}
+		if u.User.Password != "" {
+			fmt.Fprintf(&b, "    password: %s\n", redacted)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// redactURL strips the "user:pass@" credentials from a server or proxy URL,
+// a URL which can not be parsed is redacted if it may contain credentials
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil && strings.Contains(raw, "@") {
+		return redacted
+	}
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
+
+// viewWithPreview renders the list together with the preview pane of the selected candidate
+func (modal *KubectlCfModal) viewWithPreview() string {
+	listView := modal.list.View()
+	candidate, ok := modal.list.SelectedItem().(Candidate)
+	if !ok {
+		return listView
+	}
+
+	frameWidth, frameHeight := previewStyle.GetFrameSize()
+	if modal.previewSideBySide() {
+		pane := previewStyle.
+			Width(modal.width - lipgloss.Width(listView) - frameWidth - 1).
+			MaxHeight(modal.list.Height()).
+			Render(modal.preview(candidate))
+		return lipgloss.JoinHorizontal(lipgloss.Top, listView, " ", pane)
+	}
+	pane := previewStyle.
+		Width(modal.list.Width() - frameWidth).
+		MaxHeight(modal.height - modal.headerHeight() - modal.list.Height() - frameHeight).
+		Render(modal.preview(candidate))
+	return lipgloss.JoinVertical(lipgloss.Left, listView, pane)
+}
@@ -0,0 +1,121 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// isDangling returns true if the kubeconfig symlink points to a file which no longer exists
+func (modal *KubectlCfModal) isDangling() bool {
+	if modal.currentKubeconfigPath == "" { // an empty symlink is created on purpose when kubeconfig not exist
+		return false
+	}
+	_, err := os.Stat(kubeconfigPath)
+	return os.IsNotExist(err)
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// closestCandidate returns the candidate whose file name is the closest to the file name of path,
+// candidates which are too different are not considered, returns false if not found
+func (c Candidates) closestCandidate(path string) (Candidate, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	var closest Candidate
+	best := -1
+	for _, candidate := range c {
+		candidateName := strings.ToLower(filepath.Base(candidate.FullPath))
+		distance := levenshtein(name, candidateName)
+		if distance > max(len(name), len(candidateName))/2 { // too different
+			continue
+		}
+		if best < 0 || distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest, best >= 0
+}
+
+// startRepair enters ModeRepair, with suggestions for relinking the dangling symlink
+func (modal *KubectlCfModal) startRepair() {
+	modal.mode = ModeRepair
+	modal.suggestRepair()
+	modal.repairPrevious = ""
+	if previous, err := readPreviousKubeconfigPath(); err == nil && previous != "" {
+		if _, err := os.Stat(previous); err == nil {
+			modal.repairPrevious = previous
+		}
+	}
+}
+
+// suggestRepair suggests the candidate closest to the missing symlink target, among the candidates scanned so far
+func (modal *KubectlCfModal) suggestRepair() {
+	modal.repairSuggestion = ""
+	if closest, ok := modal.candidates.closestCandidate(modal.currentKubeconfigPath); ok {
+		modal.repairSuggestion = closest.FullPath
+	}
+}
+
+func (modal *KubectlCfModal) updateRepair(msg tea.Msg) tea.Cmd {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return nil
+	}
+	switch keyMsg.String() {
+	case "s":
+		if modal.repairSuggestion != "" {
+			return modal.switchTo(modal.repairSuggestion)
+		}
+	case "p":
+		if modal.repairPrevious != "" {
+			return modal.switchTo(modal.repairPrevious)
+		}
+	case "enter", "l":
+		modal.mode = ModeSelect
+		modal.layout()
+		return modal.watchSources() // nothing changes if the sources are already watched once scanned
+	case "q", "esc":
+		return tea.Quit
+	}
+	return nil
+}
+
+func (modal *KubectlCfModal) viewRepair() string {
+	var b strings.Builder
+	target, _ := os.Readlink(kubeconfigPath) // differs from currentKubeconfigPath if decrypted from an encrypted kubeconfig
+	b.WriteString(warning(t("danglingSymlink", kubeconfigPath, resolveSymlinkTarget(target))))
+	b.WriteString("\n\n")
+	if modal.repairSuggestion != "" {
+		b.WriteString(t("repairWithSuggestion", info(modal.repairSuggestion)) + "\n")
+	} else if modal.scanning() {
+		b.WriteString(t("repairScanning") + "\n")
+	}
+	if modal.repairPrevious != "" {
+		b.WriteString(t("repairWithPrevious", info(modal.repairPrevious)) + "\n")
+	}
+	b.WriteString(t("repairFromList") + "\n")
+	b.WriteString(t("repairQuit") + "\n")
+	return docStyle.Render(b.String())
+}
@@ -0,0 +1,49 @@
+package cf
+
+import (
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"prod", "", 4},
+		{"prod", "prod", 0},
+		{"prod", "prod1", 1},
+		{"kitten", "sitting", 3},
+		{"集群", "集群a", 1}, // by runes, not bytes
+	} {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestClosestCandidate(t *testing.T) {
+	candidates := Candidates{
+		{Name: "prod1", FullPath: "/kube/prod1.yaml"},
+		{Name: "prod-eu", FullPath: "/kube/prod-eu.yaml"},
+		{Name: "staging", FullPath: "/other/Staging.yaml"},
+	}
+	for _, c := range []struct {
+		path string
+		want string
+	}{
+		{"/kube/prod.yaml", "/kube/prod1.yaml"},
+		{"/kube/prod-us.yaml", "/kube/prod-eu.yaml"},
+		{"/kube/staging.yaml", "/other/Staging.yaml"}, // by file name only, case-insensitively
+		{"/kube/development.yaml", ""},                // too different
+		{"", ""},
+	} {
+		closest, ok := candidates.closestCandidate(c.path)
+		if ok != (c.want != "") || closest.FullPath != c.want {
+			t.Errorf("closestCandidate(%q) = %q, %v, want %q", c.path, closest.FullPath, ok, c.want)
+		}
+	}
+	if _, ok := Candidates(nil).closestCandidate("/kube/prod.yaml"); ok {
+		t.Error("expect no candidate among no candidates")
+	}
+}
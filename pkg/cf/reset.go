@@ -0,0 +1,153 @@
+package cf
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+	"github.com/pkg/errors"
+)
+
+const resetArgs = "[--original] [--purge [--purge-key]] [--yes]"
+
+// runReset implements "cf reset", which undoes the takeover of kubectl-cf:
+// the kubeconfig symlink is replaced by a regular copy of its target,
+// or by the original kubeconfig file moved aside when kubectl-cf took control of it
+func runReset(args []string) error {
+	flags := flag.NewFlagSet("cf reset", flag.ContinueOnError)
+	original := flags.Bool("original", false, "restore the original kubeconfig file backed up by kubectl-cf, instead of copying the current one")
+	purge := flags.Bool("purge", false, "remove the kubectl-cf config dir as well, including the journal and the trash")
+	purgeKey := flags.Bool("purge-key", false, "remove the config dir even if it contains the key file of encrypted kubeconfigs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || (*purgeKey && !*purge) {
+		return errors.New(t("commandUsage", "reset", resetArgs))
+	}
+	if *purge && !*purgeKey && keyFileInConfigDir() {
+		return errors.New(t("refuseToPurgeKey", kubectlCfConfigDir, keyFilePath))
+	}
+
+	stat, err := os.Lstat(kubeconfigPath)
+	if err != nil {
+		return errors.Wrap(err, "os.Lstat error")
+	}
+	if !sys.IsSymlink(stat) {
+		fmt.Println(t("kubeconfigIsNotASymlink", kubeconfigPath))
+	} else if err := resetKubeconfig(*original); err != nil {
+		return err
+	}
+
+	if *purge {
+		return purgeConfigDir(*purgeKey)
+	}
+	return nil
+}
+
+// resetKubeconfig replaces the kubeconfig symlink with a regular file
+func resetKubeconfig(original bool) error {
+	o := beginOperation(t("resetDescription", kubeconfigPath))
+	defer o.Commit()
+
+	if original {
+		originalPath, err := findOriginalKubeconfig()
+		if err != nil {
+			return err
+		}
+		if err := o.ReplaceSymlinkWithFile(originalPath, kubeconfigPath, false); err != nil {
+			return err
+		}
+		fmt.Println(text(t("restoredOriginalKubeconfig", info(kubeconfigPath), info(originalPath))))
+		return nil
+	}
+
+	raw, err := os.Readlink(kubeconfigPath) // for encrypted kubeconfig files, this is the decrypted runtime file
+	if err != nil {
+		return errors.Wrap(err, "os.Readlink error")
+	}
+	target := resolveSymlinkTarget(raw)
+	if target == "" {
+		return errors.New(t("symlinkHasNoTarget", kubeconfigPath))
+	}
+	if err := o.ReplaceSymlinkWithFile(target, kubeconfigPath, true); err != nil {
+		return err
+	}
+	wipeReplacedRuntimeFile(raw, kubeconfigPath)
+	fmt.Println(text(t("resetKubeconfigTo", info(kubeconfigPath), info(target))))
+	return nil
+}
+
+// findOriginalKubeconfig finds the regular kubeconfig file which kubectl-cf moved aside most recently
+// when taking control of the kubeconfig, by the journal, operations undone are ignored
+func findOriginalKubeconfig() (string, error) {
+	entries, err := ReadJournal()
+	if err != nil {
+		return "", err
+	}
+	undone := undoneEntries(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if undone[entries[i].ID] {
+			continue
+		}
+		steps := entries[i].Steps
+		for j := len(steps) - 1; j >= 0; j-- {
+			if steps[j].Action != StepRename || !isSamePath(steps[j].From, kubeconfigPath) {
+				continue
+			}
+			if _, err := os.Stat(steps[j].Path); err != nil {
+				return "", errors.New(t("originalKubeconfigMissing", steps[j].Path))
+			}
+			return steps[j].Path, nil
+		}
+	}
+	return "", errors.New(t("noOriginalKubeconfig"))
+}
+
+// resetConfirmDetail tells what "cf reset --purge" removes, shown before the confirmation
+func resetConfirmDetail(args []string) string {
+	if !slices.Contains(args, "--purge") {
+		return ""
+	}
+	if keyFileInConfigDir() {
+		return t("confirmPurgeKey", kubectlCfConfigDir, keyFilePath)
+	}
+	return t("confirmPurge", kubectlCfConfigDir)
+}
+
+// keyFileInConfigDir returns true if the key file exists in the kubectl-cf config dir,
+// which is the only copy of the key unless it is backed up, it can not be generated again
+func keyFileInConfigDir() bool {
+	if _, err := os.Lstat(keyFilePath); err != nil {
+		return false
+	}
+	dir, err := filepath.Abs(kubectlCfConfigDir)
+	if err != nil {
+		return true
+	}
+	key, err := filepath.Abs(keyFilePath)
+	return err != nil || isInDirs(key, []string{dir})
+}
+
+// purgeConfigDir removes the kubectl-cf config dir, it refuses to remove the key file unless purgeKey is true
+func purgeConfigDir(purgeKey bool) error {
+	dir, err := filepath.Abs(kubectlCfConfigDir)
+	if err != nil {
+		return errors.Wrap(err, "filepath.Abs error")
+	}
+	for _, protected := range []string{"/", homeDir, kubeDir, kubeconfigDir} {
+		if isSamePath(dir, protected) {
+			return errors.New(t("refuseToPurge", dir))
+		}
+	}
+	if !purgeKey && keyFileInConfigDir() {
+		return errors.New(t("refuseToPurgeKey", dir, keyFilePath))
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "os.RemoveAll error")
+	}
+	fmt.Println(text(t("purgedConfigDir", info(dir))))
+	return nil
+}
@@ -0,0 +1,98 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// takeControlForTest moves the regular kubeconfig file aside like kubectl-cf does when taking control of it
+func takeControlForTest(t *testing.T, content string) string {
+	t.Helper()
+	_ = os.Remove(kubeconfigPath)
+	_ = os.Remove(journalPath)
+	writeTestFile(t, kubeconfigDir, filepath.Base(kubeconfigPath), content)
+	original := filepath.Join(kubeconfigDir, DefaultKubeconfigBaseName+".yaml")
+	t.Cleanup(func() { _ = os.Remove(original) })
+
+	o := beginOperation("take control")
+	if err := o.Rename(kubeconfigPath, original); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.CreateSymlink(original, kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+	o.Commit()
+	return original
+}
+
+func TestResetOriginalUsesJournal(t *testing.T) {
+	original := takeControlForTest(t, "original")
+	other := writeTestFile(t, t.TempDir(), "other.yaml", "other")
+	(&KubectlCfModal{currentKubeconfigPath: original}).symlinkConfigPathTo(other)
+
+	// an older backup must not be mistaken for the original kubeconfig
+	older := writeTestFile(t, kubeconfigDir, filepath.Base(kubeconfigPath)+"-backup-1", "older")
+	t.Cleanup(func() { _ = os.Remove(older) })
+	if err := os.Chtimes(older, time.Now(), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resetKubeconfig(true); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Lstat(kubeconfigPath)
+	if err != nil || !stat.Mode().IsRegular() {
+		t.Fatalf("kubeconfig is not a regular file after reset: %v", err)
+	}
+	if content, _ := os.ReadFile(kubeconfigPath); string(content) != "original" {
+		t.Errorf("kubeconfig is %q after reset, want the original one", content)
+	}
+}
+
+func TestResetOriginalIgnoresUndoneTakeover(t *testing.T) {
+	takeControlForTest(t, "original")
+	if err := Undo(lastEntry(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findOriginalKubeconfig(); err == nil {
+		t.Error("expect no original kubeconfig, the takeover is undone")
+	}
+}
+
+func TestPurgeConfigDirKeepsKey(t *testing.T) {
+	defer setConfigDir(kubectlCfConfigDir)
+	for _, c := range []struct {
+		name     string
+		key      bool
+		purgeKey bool
+		removed  bool
+	}{
+		{name: "no key", removed: true},
+		{name: "key", key: true},
+		{name: "key purged explicitly", key: true, purgeKey: true, removed: true},
+	} {
+		dir := filepath.Join(t.TempDir(), "kubectl-cf")
+		setConfigDir(dir)
+		writeTestFile(t, dir, JournalFileName, "")
+		if c.key {
+			writeTestFile(t, dir, KeyFileName, "AGE-SECRET-KEY-1")
+		}
+		if detail := resetConfirmDetail([]string{"--purge"}); c.key && !strings.Contains(detail, keyFilePath) {
+			t.Errorf("%s: the confirmation does not mention the key file: %q", c.name, detail)
+		}
+
+		err := purgeConfigDir(c.purgeKey)
+		if c.removed != (err == nil) {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if _, statErr := os.Stat(dir); c.removed != os.IsNotExist(statErr) {
+			t.Errorf("%s: expect the config dir removed: %t, got %v", c.name, c.removed, statErr)
+		}
+		if _, statErr := os.Stat(keyFilePath); c.key && !c.purgeKey && statErr != nil {
+			t.Errorf("%s: the key file is removed: %s", c.name, statErr)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package cf
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pkg/errors"
+)
+
+// sourceScan is the result of scanning a source in kubeconfigSources
+type sourceScan struct {
+	candidates   Candidates
+	sourceErrors []SourceError
+
+	// dirs are the directories to watch for changes, including subdirectories of recursive sources, see watchSources
+	dirs []string
+}
+
+// scanSource lists candidates in the directories expanded from source, it may take long on network shares
+func scanSource(source Source, currentKubeconfigPath string) sourceScan {
+	if source.Exec != "" {
+		return scanExecSource(source, currentKubeconfigPath)
+	}
+	if isCatalogURL(source.Path) {
+		return scanCatalogSource(source, currentKubeconfigPath)
+	}
+	dirs, missing := expandSource(source, currentKubeconfigPath)
+	for _, dir := range missing {
+		logger.Debugf("Skip source %s: %s is not a directory", source.Path, dir)
+	}
+	var scannedDirs []string
+	for _, dir := range dirs {
+		scannedDirs = append(scannedDirs, dir.Path)
+	}
+	trustedDirs := trustedDirs(currentKubeconfigPath, scannedDirs...)
+
+	var scan sourceScan
+	for _, dir := range dirs {
+		candidatesInDir, dirsInSource, err := ListKubeconfigCandidatesInSource(dir)
+		if err != nil {
+			scan.dirs = append(scan.dirs, dir.Path)
+			scan.sourceErrors = append(scan.sourceErrors, SourceError{Source: dir.Path, Err: err})
+			continue
+		}
+		scan.dirs = append(scan.dirs, dirsInSource...)
+		for _, candidate := range candidatesInDir {
+			if candidate.FullPath == kubeconfigPath { // filter out the current kubeconfig
+				continue
+			}
+			candidate.Warnings = auditFile(candidate.FullPath, trustedDirs).Issues()
+			candidate.Source, candidate.Origin = dir.Path, dir
+			candidate.Tags = config.TagsOf(candidate.Name)
+			scan.candidates = append(scan.candidates, candidate)
+		}
+	}
+	saveIndex()
+	return scan
+}
+
+// timeout returns how long the source may take to scan, before it is marked as stale
+func (s Source) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return sourceTimeout
+}
+
+// staleScan is the result of a source which is not scanned in time, previous is the last result of the source, if any
+func staleScan(source Source, previous *sourceScan) sourceScan {
+	scan := sourceScan{sourceErrors: []SourceError{{
+		Source: source.label(),
+		Err:    errors.New(t("sourceTimeout", source.timeout())),
+		Stale:  true,
+	}}}
+	if previous != nil {
+		scan.candidates = previous.candidates
+	}
+	return scan
+}
+
+// scanSources scans all kubeconfigSources concurrently, and waits until each of them is done or timed out
+func scanSources(currentKubeconfigPath string) []sourceScan {
+	scans := make([]sourceScan, len(kubeconfigSources))
+	var wg sync.WaitGroup
+	for i, source := range kubeconfigSources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := make(chan sourceScan, 1) // buffered, the scan never blocks after a timeout
+			go func() { done <- scanSource(source, currentKubeconfigPath) }()
+			select {
+			case scans[i] = <-done:
+			case <-time.After(source.timeout()):
+				scans[i] = staleScan(source, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	return scans
+}
+
+// mergeScans joins the candidates of sources in order, files found in more than one source are listed once,
+// and like PATH, names found in earlier sources shadow the same names in later sources
+func mergeScans(scans []sourceScan) (Candidates, []SourceError) {
+	var candidates Candidates
+	var sourceErrors []SourceError
+	listed := map[string]bool{}
+	seen := map[string]string{} // name -> full path of the first candidate with the name
+	for _, scan := range scans {
+		sourceErrors = append(sourceErrors, scan.sourceErrors...)
+		for _, candidate := range scan.candidates {
+			if listed[candidate.FullPath] { // overlapped sources
+				continue
+			}
+			listed[candidate.FullPath] = true
+			if first, ok := seen[candidate.Name]; ok {
+				candidate.ShadowedBy = first
+			} else {
+				seen[candidate.Name] = candidate.FullPath
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	qualifyNames(candidates)
+	return candidates, sourceErrors
+}
+
+// qualifyNames sets the qualifiers of candidates to the fewest trailing segments of their sources
+// which tell apart all sources of candidates with the same name, see Candidate.QualifiedName
+func qualifyNames(candidates Candidates) {
+	byName := map[string][]int{}
+	for i, candidate := range candidates {
+		byName[candidate.Name] = append(byName[candidate.Name], i)
+	}
+	for _, indexes := range byName {
+		for depth := 1; ; depth++ {
+			sources := map[string]string{} // qualifier -> source
+			unique, whole := true, true
+			for _, i := range indexes {
+				qualifier, isWhole := trailingSegments(candidates[i].Source, depth)
+				whole = whole && isWhole
+				if source, ok := sources[qualifier]; ok && source != candidates[i].Source {
+					unique = false
+				}
+				sources[qualifier] = candidates[i].Source
+			}
+			if unique || whole {
+				for _, i := range indexes {
+					candidates[i].Qualifier, _ = trailingSegments(candidates[i].Source, depth)
+				}
+				break
+			}
+		}
+	}
+}
+
+// trailingSegments returns the last n segments of path joined by "/", and whether they are the whole path
+func trailingSegments(path string, n int) (string, bool) {
+	var segments []string
+	for segment := range strings.SplitSeq(filepath.ToSlash(filepath.Clean(path)), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if n >= len(segments) {
+		return strings.Join(segments, "/"), true
+	}
+	return strings.Join(segments[len(segments)-n:], "/"), false
+}
+
+// sourceScannedMsg is sent when a source is scanned in the background, see startScan
+type sourceScannedMsg struct {
+	generation int
+	index      int
+	scan       sourceScan
+}
+
+// sourceTimeoutMsg is sent when a source is not scanned in time, see startScan
+type sourceTimeoutMsg struct {
+	generation int
+	index      int
+}
+
+// startScan scans all kubeconfigSources in the background, candidates of each source are shown as soon as it is done,
+// a source which is not done in time is marked as stale, and updated if it is done later.
+// The candidate at focusPath is highlighted once it is found.
+func (modal *KubectlCfModal) startScan(focusPath string) tea.Cmd {
+	modal.scanGeneration++ // results of earlier scans are outdated
+	modal.focusPath = focusPath
+	if len(modal.scans) != len(kubeconfigSources) {
+		modal.scans = make([]*sourceScan, len(kubeconfigSources))
+	}
+	modal.scanPending = make([]bool, len(kubeconfigSources))
+
+	generation, currentKubeconfigPath := modal.scanGeneration, modal.currentKubeconfigPath
+	cmds := []tea.Cmd{modal.list.StartSpinner()}
+	for i, source := range kubeconfigSources {
+		modal.scanPending[i] = true
+		cmds = append(cmds,
+			func() tea.Msg {
+				return sourceScannedMsg{generation: generation, index: i, scan: scanSource(source, currentKubeconfigPath)}
+			},
+			tea.Tick(source.timeout(), func(time.Time) tea.Msg {
+				return sourceTimeoutMsg{generation: generation, index: i}
+			}),
+		)
+	}
+	modal.rebuildCandidates()
+	return tea.Batch(cmds...)
+}
+
+// updateScan handles the results of startScan, in any mode, the sources are watched once all of them are scanned
+func (modal *KubectlCfModal) updateScan(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case sourceScannedMsg:
+		if msg.generation != modal.scanGeneration {
+			return nil
+		}
+		modal.scans[msg.index] = &msg.scan // a stale source is updated as well
+		modal.scanPending[msg.index] = false
+	case sourceTimeoutMsg:
+		if msg.generation != modal.scanGeneration || !modal.scanPending[msg.index] {
+			return nil
+		}
+		logger.Debugf("Source %s is not scanned in time, marked as stale", kubeconfigSources[msg.index].label())
+		scan := staleScan(kubeconfigSources[msg.index], modal.scans[msg.index])
+		modal.scans[msg.index] = &scan
+		modal.scanPending[msg.index] = false
+	default:
+		return nil
+	}
+	modal.rebuildCandidates()
+	if modal.mode == ModeRepair {
+		modal.suggestRepair()
+	}
+	if modal.scanning() {
+		return nil
+	}
+	modal.list.StopSpinner()
+	if modal.guessArg != "" {
+		return modal.switchToGuess() // the program quits, sources are not watched
+	}
+	return modal.watchSources()
+}
+
+// scanning returns true if any source is still being scanned
+func (modal *KubectlCfModal) scanning() bool {
+	for _, pending := range modal.scanPending {
+		if pending {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildCandidates merges the scanned sources into the list, sources which can not be read are shown in the banner.
+// The selected candidate keeps highlighted, unless the candidate at focusPath is found.
+func (modal *KubectlCfModal) rebuildCandidates() {
+	selected, _ := modal.list.SelectedItem().(Candidate)
+	var scans []sourceScan
+	for _, scan := range modal.scans {
+		if scan != nil {
+			scans = append(scans, *scan)
+		}
+	}
+	modal.candidates, modal.sourceErrors = mergeScans(scans)
+	modal.sortCandidates()
+	modal.previewCache = nil
+	modal.applyGroup()
+	if modal.width > 0 { // the banner may come and go
+		modal.layout()
+	}
+
+	if modal.focusPath != "" && modal.focusOn(modal.focusPath) {
+		modal.focusPath = ""
+	} else if selected.FullPath != "" {
+		modal.focusOn(selected.FullPath)
+	}
+	if !modal.scanning() {
+		modal.focusPath = ""
+	}
+}
@@ -0,0 +1,213 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMergeScans(t *testing.T) {
+	scans := []sourceScan{
+		{candidates: Candidates{
+			{Name: "prod", FullPath: "/home/u/clients/a/kube/prod.yaml", Source: "/home/u/clients/a/kube"},
+			{Name: "dev", FullPath: "/home/u/clients/a/kube/dev.yaml", Source: "/home/u/clients/a/kube"},
+		}},
+		{candidates: Candidates{
+			{Name: "prod", FullPath: "/home/u/clients/b/kube/prod.yaml", Source: "/home/u/clients/b/kube"},
+			{Name: "dev", FullPath: "/home/u/clients/a/kube/dev.yaml", Source: "/home/u/clients/a/kube"}, // overlapped
+		}},
+		{candidates: Candidates{
+			{Name: "prod", FullPath: "/work/prod.yaml", Source: "/work"},
+			{Name: "staging", FullPath: "/work/staging.yaml", Source: "/work"},
+		}, sourceErrors: []SourceError{{Source: "/missing"}}},
+	}
+
+	candidates, sourceErrors := mergeScans(scans)
+	if len(sourceErrors) != 1 {
+		t.Errorf("got %d source errors, want 1", len(sourceErrors))
+	}
+	var got []string
+	for _, candidate := range candidates {
+		got = append(got, candidate.DisplayName())
+	}
+	want := []string{"prod", "dev", "b/kube/prod", "work/prod", "staging"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if candidates[2].ShadowedBy != "/home/u/clients/a/kube/prod.yaml" {
+		t.Errorf("b/kube/prod is shadowed by %q", candidates[2].ShadowedBy)
+	}
+	if candidates[0].QualifiedName() != "a/kube/prod" || candidates[4].QualifiedName() != "work/staging" {
+		t.Errorf("unexpected qualified names %s, %s", candidates[0].QualifiedName(), candidates[4].QualifiedName())
+	}
+
+	for arg, want := range map[string][]string{
+		"prod":        {"/home/u/clients/a/kube/prod.yaml"},
+		"a/kube/prod": {"/home/u/clients/a/kube/prod.yaml"},
+		"b/kube/prod": {"/home/u/clients/b/kube/prod.yaml"},
+		"work/prod":   {"/work/prod.yaml"},
+		"st":          {"/work/staging.yaml"},
+		"b/":          {"/home/u/clients/b/kube/prod.yaml"},
+		"kube/prod":   nil, // qualified by the parent dirs, since both sources are named kube
+		"missing":     nil,
+	} {
+		var got []string
+		for _, candidate := range Candidates(candidates).Guess(arg) {
+			got = append(got, candidate.FullPath)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("guess %s: got %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestGuessAmbiguousQualifiedName(t *testing.T) {
+	candidates, _ := mergeScans([]sourceScan{{candidates: Candidates{
+		{Name: "prod", FullPath: "/kube/a/prod.yaml", Source: "/kube"},
+		{Name: "prod", FullPath: "/kube/b/prod.yaml", Source: "/kube"},
+	}}})
+	if got := candidates.Guess("kube/prod"); len(got) != 2 {
+		t.Errorf("got %d candidates for an ambiguous qualified name, want 2", len(got))
+	}
+}
+
+func TestTrailingSegments(t *testing.T) {
+	for _, c := range []struct {
+		path  string
+		n     int
+		want  string
+		whole bool
+	}{
+		{"/home/u/kube", 1, "kube", false},
+		{"/home/u/kube/", 2, "u/kube", false},
+		{"/home/u/kube", 3, "home/u/kube", true},
+		{"/home/u/kube", 5, "home/u/kube", true},
+		{"", 1, ".", true},
+	} {
+		got, whole := trailingSegments(c.path, c.n)
+		if got != c.want || whole != c.whole {
+			t.Errorf("trailingSegments(%q, %d) = %q, %v, want %q, %v", c.path, c.n, got, whole, c.want, c.whole)
+		}
+	}
+}
+
+// finishScan delivers the results of all kubeconfigSources to modal, as if they are scanned in the background,
+// returns the command of the last result
+func finishScan(t *testing.T, modal *KubectlCfModal) tea.Cmd {
+	t.Helper()
+	t.Cleanup(func() {
+		if modal.watcher != nil {
+			_ = modal.watcher.Close()
+		}
+	})
+	var cmd tea.Cmd
+	for i, source := range kubeconfigSources {
+		cmd = modal.updateScan(sourceScannedMsg{generation: modal.scanGeneration, index: i, scan: scanSource(source, modal.currentKubeconfigPath)})
+	}
+	return cmd
+}
+
+func TestInitRepairScansInBackground(t *testing.T) {
+	similar := writeTestFile(t, kubeconfigDir, "prod1.yaml", "kind: Config\n")
+	t.Cleanup(func() { _ = os.Remove(similar) })
+	resetKubeconfigSymlink(t, filepath.Join(kubeconfigDir, "prod.yaml"))
+
+	modal := &KubectlCfModal{}
+	if cmd := modal.Init(); cmd == nil {
+		t.Fatal("expect sources scanned in the background")
+	}
+	if modal.mode != ModeRepair || modal.repairSuggestion != "" {
+		t.Fatalf("mode %d, suggestion %q before the scan, want ModeRepair without a suggestion", modal.mode, modal.repairSuggestion)
+	}
+	finishScan(t, modal)
+	if modal.repairSuggestion != similar {
+		t.Errorf("suggestion %q after the scan, want %s", modal.repairSuggestion, similar)
+	}
+
+	// the list opened from the repair view is refreshed when files change, like the list opened directly
+	modal.watchedDirs = nil
+	modal.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if modal.mode != ModeSelect || !slices.Contains(modal.watchedDirs, kubeconfigDir) {
+		t.Errorf("mode %d, watching %v after leaving the repair view, want ModeSelect watching %s", modal.mode, modal.watchedDirs, kubeconfigDir)
+	}
+}
+
+func TestSwitchToGuessAfterScan(t *testing.T) {
+	current := writeTestFile(t, kubeconfigDir, "current.yaml", "kind: Config\n")
+	similar := writeTestFile(t, kubeconfigDir, "prod1.yaml", "kind: Config\n")
+	t.Cleanup(func() { _ = os.Remove(current); _ = os.Remove(similar) })
+
+	for _, c := range []struct {
+		arg  string
+		mode int
+	}{
+		{"prod1", ModeSwitching},
+		{"missing", ModeQuit},
+	} {
+		modal := &KubectlCfModal{
+			list:                  list.New(nil, list.NewDefaultDelegate(), 0, 0),
+			currentKubeconfigPath: current,
+			mode:                  ModeSwitching,
+			guessArg:              c.arg,
+		}
+		modal.startScan("")
+		if modal.guessArg != c.arg {
+			t.Fatalf("%s: guessed before the scan", c.arg)
+		}
+		if cmd := finishScan(t, modal); cmd == nil {
+			t.Errorf("%s: expect a command after the scan", c.arg)
+		}
+		if modal.mode != c.mode || modal.guessArg != "" {
+			t.Errorf("%s: mode %d, guess %q after the scan, want mode %d", c.arg, modal.mode, modal.guessArg, c.mode)
+		}
+		if c.mode == ModeSwitching && modal.switchTarget != similar {
+			t.Errorf("%s: switching to %s, want %s", c.arg, modal.switchTarget, similar)
+		}
+	}
+}
+
+func TestSourceTimeoutMarksStale(t *testing.T) {
+	path := writeTestFile(t, kubeconfigDir, "stale.yaml", "kind: Config\n")
+	t.Cleanup(func() { _ = os.Remove(path) })
+	modal := &KubectlCfModal{list: list.New(nil, list.NewDefaultDelegate(), 0, 0), currentKubeconfigPath: path}
+
+	// the first scan is done in time
+	modal.startScan("")
+	finishScan(t, modal)
+	if len(modal.candidates) == 0 || len(modal.sourceErrors) != 0 {
+		t.Fatalf("got candidates %v, errors %v after the first scan", candidateNames(modal.candidates), modal.sourceErrors)
+	}
+	want := len(modal.candidates)
+
+	// the next scan is not, candidates of the first scan are kept
+	modal.startScan("")
+	generation := modal.scanGeneration
+	modal.updateScan(sourceTimeoutMsg{generation: generation - 1, index: 0}) // outdated
+	if !modal.scanning() {
+		t.Fatal("an outdated timeout is handled")
+	}
+	for i := range kubeconfigSources {
+		modal.updateScan(sourceTimeoutMsg{generation: generation, index: i})
+	}
+	if modal.scanning() || len(modal.candidates) != want {
+		t.Errorf("scanning %v with %d candidates after timeouts, want %d candidates", modal.scanning(), len(modal.candidates), want)
+	}
+	if len(modal.sourceErrors) != len(kubeconfigSources) || !modal.sourceErrors[0].Stale {
+		t.Errorf("got errors %v, want stale sources", modal.sourceErrors)
+	}
+
+	// a stale source is updated once it is done, even after the timeout
+	modal.updateScan(sourceScannedMsg{generation: generation, index: 0, scan: scanSource(kubeconfigSources[0], path)})
+	if len(modal.sourceErrors) != len(kubeconfigSources)-1 || len(modal.candidates) != want {
+		t.Errorf("got errors %v, %d candidates after the stale source is done, want %d", modal.sourceErrors, len(modal.candidates), want)
+	}
+	// a timeout after the source is done is ignored
+	modal.updateScan(sourceTimeoutMsg{generation: generation, index: 0})
+	if len(modal.sourceErrors) != len(kubeconfigSources)-1 {
+		t.Errorf("got errors %v after a late timeout", modal.sourceErrors)
+	}
+}
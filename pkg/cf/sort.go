@@ -0,0 +1,153 @@
+package cf
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sort modes of the list, cycled by "s"
+const (
+	SortByName      = "name"
+	SortByMtime     = "mtime"
+	SortByLastUsed  = "last-used"
+	SortByFrequency = "frequency"
+)
+
+// sortModes are all sort modes, in the order they are cycled
+var sortModes = []string{SortByName, SortByMtime, SortByLastUsed, SortByFrequency}
+
+// Usage is the usage statistics of a kubeconfig file
+type Usage struct {
+	Count    int       `json:"count"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// UsageStats maps the full paths of kubeconfig files to their usage statistics
+type UsageStats map[string]*Usage
+
+// ReadUsageStats reads the usage statistics, empty if never recorded
+func ReadUsageStats() (UsageStats, error) {
+	stats := UsageStats{}
+	f, err := os.ReadFile(usagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return nil, errors.Wrap(err, "os.ReadFile error")
+	}
+	if err := json.Unmarshal(f, &stats); err != nil {
+		return nil, errors.Wrap(err, "corrupted usage statistics")
+	}
+	return stats, nil
+}
+
+// recordUsage counts a switch to the kubeconfig at path, failures are only logged.
+// The usage file is read and written while usageLockPath is locked, so concurrent switches are all counted.
+func recordUsage(path string) {
+	unlock, err := lockConfigFile(usageLockPath)
+	if err != nil {
+		logger.Warnf("Unable to record usage: %s", err)
+		return
+	}
+	defer unlock()
+
+	stats, err := ReadUsageStats()
+	if err != nil {
+		logger.Warnf("Unable to read usage statistics, reset: %s", err)
+		stats = UsageStats{}
+	}
+	usage, ok := stats[path]
+	if !ok {
+		usage = &Usage{}
+		stats[path] = usage
+	}
+	usage.Count++
+	usage.LastUsed = time.Now()
+
+	if err := writeUsageStats(stats); err != nil {
+		logger.Warnf("Unable to record usage: %s", err)
+	}
+}
+
+// writeUsageStats replaces the usage file with stats, other kubectl-cf processes never read a partially written file
+func writeUsageStats(stats UsageStats) error {
+	f, err := json.Marshal(stats)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+	tmp, err := os.CreateTemp(kubectlCfConfigDir, ".usage-*") // created with mode 0600
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp error")
+	}
+	_, err = tmp.Write(f)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), usagePath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(err, "write usage statistics error")
+	}
+	return nil
+}
+
+// isSortMode returns true if mode is one of sortModes
+func isSortMode(mode string) bool {
+	return slices.Contains(sortModes, mode)
+}
+
+// nextSortMode returns the sort mode after mode
+func nextSortMode(mode string) string {
+	return sortModes[(slices.Index(sortModes, mode)+1)%len(sortModes)]
+}
+
+// SortBy sorts candidates by mode in place, the most recent and the most frequently used first,
+// ties are broken by name, then by the order of discovery
+func (c Candidates) SortBy(mode string, stats UsageStats) {
+	usage := func(candidate Candidate) Usage {
+		if u, ok := stats[candidate.FullPath]; ok {
+			return *u
+		}
+		return Usage{}
+	}
+	slices.SortStableFunc(c, func(a, b Candidate) int {
+		var result int
+		switch mode {
+		case SortByMtime:
+			result = b.ModTime.Compare(a.ModTime)
+		case SortByLastUsed:
+			result = usage(b).LastUsed.Compare(usage(a).LastUsed)
+		case SortByFrequency:
+			result = cmp.Compare(usage(b).Count, usage(a).Count)
+		}
+		if result != 0 {
+			return result
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+// sortCandidates sorts candidates by the sort mode of the modal
+func (modal *KubectlCfModal) sortCandidates() {
+	stats, err := ReadUsageStats()
+	if err != nil {
+		logger.Debugf("Unable to read usage statistics: %s", err)
+	}
+	modal.candidates.SortBy(modal.sortMode, stats)
+}
+
+// cycleSortMode switches to the next sort mode, keeping the selected candidate highlighted
+func (modal *KubectlCfModal) cycleSortMode() {
+	selected, _ := modal.list.SelectedItem().(Candidate)
+	modal.sortMode = nextSortMode(modal.sortMode)
+	modal.sortCandidates()
+	modal.applyGroup()
+	modal.focusOn(selected.FullPath)
+}
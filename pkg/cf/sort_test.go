@@ -0,0 +1,96 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSortBy(t *testing.T) {
+	now := time.Now()
+	candidates := func() Candidates {
+		return Candidates{
+			{Name: "b", FullPath: "/b", ModTime: now.Add(-2 * time.Hour)},
+			{Name: "a", FullPath: "/a", ModTime: now.Add(-3 * time.Hour)},
+			{Name: "c", FullPath: "/c", ModTime: now.Add(-time.Hour)},
+			{Name: "a", FullPath: "/other/a", ModTime: now.Add(-time.Hour)},
+		}
+	}
+	stats := UsageStats{
+		"/a": {Count: 1, LastUsed: now},
+		"/b": {Count: 5, LastUsed: now.Add(-time.Hour)},
+	}
+
+	for mode, want := range map[string][]string{
+		SortByName:      {"/a", "/other/a", "/b", "/c"}, // ties keep the order of discovery
+		SortByMtime:     {"/other/a", "/c", "/b", "/a"},
+		SortByLastUsed:  {"/a", "/b", "/other/a", "/c"},
+		SortByFrequency: {"/b", "/a", "/other/a", "/c"},
+	} {
+		sorted := candidates()
+		sorted.SortBy(mode, stats)
+		for i, candidate := range sorted {
+			if candidate.FullPath != want[i] {
+				t.Errorf("sort by %s: got %v, want %v", mode, sorted, want)
+				break
+			}
+		}
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	recordUsage("/a")
+	recordUsage("/a")
+	recordUsage("/b")
+	stats, err := ReadUsageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["/a"].Count != 2 || stats["/b"].Count != 1 {
+		t.Errorf("unexpected usage %+v, %+v", stats["/a"], stats["/b"])
+	}
+	if stats["/b"].LastUsed.Before(stats["/a"].LastUsed) {
+		t.Errorf("last used of /b is before /a")
+	}
+}
+
+func TestRecordUsageConcurrently(t *testing.T) {
+	_ = os.Remove(usagePath)
+	t.Cleanup(func() { _ = os.Remove(usagePath) })
+	const switches = 20
+	var wg sync.WaitGroup
+	for range switches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recordUsage("/concurrent")
+		}()
+	}
+	wg.Wait()
+
+	stats, err := ReadUsageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["/concurrent"] == nil || stats["/concurrent"].Count != switches {
+		t.Errorf("got usage %+v, want %d switches counted", stats["/concurrent"], switches)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(kubectlCfConfigDir, ".usage-*")); len(temps) != 0 {
+		t.Errorf("temporary files are left: %v", temps)
+	}
+}
+
+func TestNextSortMode(t *testing.T) {
+	mode := SortByName
+	for range sortModes {
+		mode = nextSortMode(mode)
+		if !isSortMode(mode) {
+			t.Fatalf("unknown sort mode %s", mode)
+		}
+	}
+	if mode != SortByName {
+		t.Errorf("sort modes do not cycle back, got %s", mode)
+	}
+}
@@ -0,0 +1,426 @@
+package cf
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Source is a source of kubeconfig files, a directory, or directories expanded from a path, see expandSource
+type Source struct {
+	// Path is the path of the source, it may contain "~", environment variables and glob patterns,
+	// and may end with RecursiveSourceSuffix to scan subdirectories
+	Path string `yaml:"path,omitempty"`
+
+	// MaxDepth is the depth of subdirectories to scan, 0 means subdirectories are not scanned,
+	// unless Path ends with RecursiveSourceSuffix, which scans RecursiveMaxDepthDefault levels by default
+	MaxDepth int `yaml:"maxDepth,omitempty"`
+
+	// Exclude are glob patterns of files and directories not to scan, in addition to defaultExcludes,
+	// matched against the base name and the path relative to the source, patterns ending with "/" only match directories,
+	// for example, "*.bak", "cache/", "archive/*.yaml"
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// Detect is how kubeconfig files are detected, one of detectModes, defaultDetectMode if empty
+	Detect string `yaml:"detect,omitempty"`
+
+	// Pattern is the regex pattern of kubeconfig file names in the source, kubeconfigFilenameMatchPattern if empty
+	Pattern string `yaml:"pattern,omitempty"`
+
+	// NameGroup is the name of the regex group in Pattern for kubeconfig names,
+	// KubeconfigFilenameMatchPatternNameGroup if empty
+	NameGroup string `yaml:"nameGroup,omitempty"`
+
+	// Prefix is prepended to the names of kubeconfig files in the source, for example, "vendor/"
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// NameTemplate is a text/template to name kubeconfig files in the source, executed with nameTemplateData,
+	// for example, "{{.CurrentContext}}", the name from Pattern is used if it fails or renders empty
+	NameTemplate string `yaml:"nameTemplate,omitempty"`
+
+	// Timeout is how long the source may take to scan, before it is marked as stale, sourceTimeout if 0
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Exec is the command of an exec source, which lists kubeconfigs by the exec protocol instead of reading Path,
+	// for example, "inventory-cf --team platform", see execListResponse,
+	// only Prefix and Timeout apply to exec sources, and to catalog sources whose Path is a URL, see isCatalogURL
+	Exec string `yaml:"exec,omitempty"`
+
+	pattern      *regexp.Regexp     // compiled Pattern, see compile
+	nameTemplate *template.Template // parsed NameTemplate, see compile
+}
+
+// nameTemplateData is the data to execute Source.NameTemplate with,
+// fields of the parsed kubeconfig are promoted, like .CurrentContext, it is nil if the file can not be parsed
+type nameTemplateData struct {
+	// Name is the name from the match pattern
+	Name string
+
+	// FileName is the base name of the file
+	FileName string
+
+	*Kubeconfig
+}
+
+// scansDirs returns true if the source is a path of directories, not an exec source or a catalog
+func (s Source) scansDirs() bool {
+	return s.Exec == "" && !isCatalogURL(s.Path)
+}
+
+// label returns Path, or Exec for exec sources, to tell the source in messages
+func (s Source) label() string {
+	if s.Exec != "" {
+		return s.Exec
+	}
+	return s.Path
+}
+
+// compile compiles Pattern and parses NameTemplate
+func (s *Source) compile() error {
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern of source %s", s.label())
+		}
+		s.pattern = pattern
+	}
+	if s.NameTemplate != "" {
+		nameTemplate, err := template.New(s.label()).Option("missingkey=error").Parse(s.NameTemplate)
+		if err != nil {
+			return errors.Wrapf(err, "invalid name template of source %s", s.label())
+		}
+		s.nameTemplate = nameTemplate
+	}
+	return nil
+}
+
+// matchPattern returns the regex pattern of kubeconfig file names in the source
+func (s Source) matchPattern() *regexp.Regexp {
+	if s.pattern != nil {
+		return s.pattern
+	}
+	return kubeconfigFilenameMatchPattern
+}
+
+// nameGroup returns the name of the regex group for kubeconfig names
+func (s Source) nameGroup() string {
+	if s.NameGroup != "" {
+		return s.NameGroup
+	}
+	return KubeconfigFilenameMatchPatternNameGroup
+}
+
+// renderName returns the name of the candidate found in the source, rendered by the name template if there is one
+func (s Source) renderName(candidate Candidate) string {
+	name := candidate.Name
+	if s.nameTemplate != nil {
+		data := nameTemplateData{Name: candidate.Name, FileName: filepath.Base(candidate.FullPath)}
+		if kubeconfig, err := ParseKubeconfigFile(candidate.FullPath); err == nil {
+			data.Kubeconfig = kubeconfig
+		}
+		var b strings.Builder
+		if err := s.nameTemplate.Execute(&b, data); err != nil {
+			logger.Debugf("Unable to name %s by template: %s", candidate.FullPath, err)
+		} else if rendered := strings.TrimSpace(b.String()); rendered != "" {
+			name = rendered
+		}
+	}
+	return name
+}
+
+// SourceError is the error reading a source directory, other sources are still read
+type SourceError struct {
+	// Source is the directory expanded from kubeconfigSources, or the command or URL of the source
+	Source string
+	Err    error
+
+	// Stale is true if the source is not scanned in time, its candidates may be outdated
+	Stale bool
+}
+
+func (e SourceError) Error() string {
+	return t("sourceError", e.Source, e.Err.Error())
+}
+
+// excluded returns true if the file or directory at rel, relative to the source, matches an exclude pattern
+func (s Source) excluded(rel string, isDir bool) bool {
+	for _, pattern := range append(slices.Clone(defaultExcludes), s.Exclude...) {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if matched, _ := path.Match(pattern, path.Base(rel)); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSource expands the path of source to directories, returned as sources with the expanded paths,
+// a leading "~" is replaced by the home dir, environment variables like $VAR are expanded,
+// and glob patterns like ~/clients/*/kube are matched against existing directories.
+// Paths which do not exist or are not directories are returned as missing.
+func expandSource(source Source, currentKubeconfigPath string) (dirs []Source, missing []string) {
+	if source.Detect == "" {
+		source.Detect = defaultDetectMode
+	}
+	if strings.HasSuffix(source.Path, RecursiveSourceSuffix) && source.MaxDepth == 0 {
+		source.MaxDepth = RecursiveMaxDepthDefault
+	}
+	expanded, ok := expandSourcePath(source.Path, currentKubeconfigPath)
+	if !ok {
+		return nil, nil
+	}
+
+	matches := []string{expanded}
+	if strings.ContainsAny(expanded, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(expanded); err != nil || len(matches) == 0 {
+			return nil, []string{expanded}
+		}
+	}
+	for _, match := range matches {
+		stat, err := os.Stat(match)
+		if (err == nil && !stat.IsDir()) || os.IsNotExist(err) {
+			missing = append(missing, match)
+			continue
+		} // other errors, like a stale network share, are reported when the directory is read
+		dir := source
+		dir.Path = match
+		dirs = append(dirs, dir)
+	}
+	return dirs, missing
+}
+
+// expandSourcePath expands "~", environment variables and the special path KubeconfigSpecialPathKubeconfigDir
+// in the path of a source, without RecursiveSourceSuffix, glob patterns are kept,
+// returns false if the path refers to an unset environment variable, which would change the meaning of the path,
+// like "$CLIENTS/kube" to "/kube"
+func expandSourcePath(entry string, currentKubeconfigPath string) (string, bool) {
+	entry = strings.TrimSuffix(entry, RecursiveSourceSuffix)
+	if entry == KubeconfigSpecialPathKubeconfigDir && isExecPath(currentKubeconfigPath) { // not a file
+		entry = kubeconfigDir
+	} else if entry == KubeconfigSpecialPathKubeconfigDir { // parse special path for kubeconfig dir
+		entry = filepath.Dir(currentKubeconfigPath)
+	}
+	var unset []string
+	expanded := os.Expand(entry, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+		return value
+	})
+	if len(unset) > 0 {
+		logger.Debugf("Skip source %s: environment variable %s not set", entry, strings.Join(unset, ", "))
+		return "", false
+	}
+	if expanded == "~" || strings.HasPrefix(expanded, "~/") || strings.HasPrefix(expanded, "~"+string(filepath.Separator)) {
+		expanded = filepath.Join(homeDir, expanded[1:])
+	}
+	return expanded, true
+}
+
+// sourceRoots returns the directories of kubeconfigSources without touching the filesystem,
+// which may hang on network shares, glob patterns are cut at the first element with a pattern
+func sourceRoots(currentKubeconfigPath string) []string {
+	var roots []string
+	for _, source := range kubeconfigSources {
+		if !source.scansDirs() {
+			continue
+		}
+		root, ok := expandSourcePath(source.Path, currentKubeconfigPath)
+		if !ok {
+			continue
+		}
+		for strings.ContainsAny(root, "*?[") {
+			root = filepath.Dir(root)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// sourceDirs returns the directories expanded from kubeconfigSources, see expandSource,
+// currentKubeconfigPath is used to resolve the special path KubeconfigSpecialPathKubeconfigDir,
+// missing directories are skipped
+func sourceDirs(currentKubeconfigPath string) []Source {
+	var dirs []Source
+	for _, source := range kubeconfigSources {
+		if !source.scansDirs() {
+			continue
+		}
+		expanded, missing := expandSource(source, currentKubeconfigPath)
+		for _, dir := range missing {
+			logger.Debugf("Skip source %s: %s is not a directory", source.Path, dir)
+		}
+		for _, dir := range expanded {
+			if !slices.ContainsFunc(dirs, func(s Source) bool { return s.Path == dir.Path }) { // overlapped globs
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// ListKubeconfigCandidatesInSource lists candidates in the directory of source, and its subdirectories up to source.MaxDepth,
+// names of candidates in subdirectories are prefixed by their relative paths, like "team/prod.yaml",
+// then by source.Prefix.
+// Symlinked directories are followed, each directory is scanned once to prevent loops,
+// and the kubectl-cf config dir is never scanned since it contains backups and trashed files.
+// The scanned directories are returned as well, including those without kubeconfig files, so they can be watched.
+func ListKubeconfigCandidatesInSource(source Source) ([]Candidate, []string, error) {
+	visited := map[string]bool{}
+	var scannedDirs []string
+	var scan func(dir, rel string, depth int) ([]Candidate, error)
+	scan = func(dir, rel string, depth int) ([]Candidate, error) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			if visited[resolved] {
+				logger.Debugf("Skip %s: already scanned as %s", dir, resolved)
+				return nil, nil
+			}
+			visited[resolved] = true
+		}
+
+		var candidates []Candidate
+		candidatesInDir, err := ListKubeconfigCandidatesInDir(dir, source, rel)
+		if err != nil {
+			return nil, err
+		}
+		scannedDirs = append(scannedDirs, dir)
+		for _, candidate := range candidatesInDir {
+			candidate.Name = source.Prefix + path.Join(rel, candidate.Name)
+			candidates = append(candidates, candidate)
+		}
+		if depth >= source.MaxDepth {
+			return candidates, nil
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "os.ReadDir error")
+		}
+		for _, entry := range entries {
+			subDir := filepath.Join(dir, entry.Name())
+			subRel := path.Join(rel, entry.Name())
+			if stat, err := os.Stat(subDir); err != nil || !stat.IsDir() { // follows symlinks
+				continue
+			}
+			if source.excluded(subRel, true) || isSamePath(subDir, kubectlCfConfigDir) {
+				continue
+			}
+			candidatesInSubDir, err := scan(subDir, subRel, depth+1)
+			if err != nil {
+				logger.Debugf("Skip %s: %s", subDir, err)
+				continue
+			}
+			candidates = append(candidates, candidatesInSubDir...)
+		}
+		return candidates, nil
+	}
+	candidates, err := scan(source.Path, "", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return candidates, scannedDirs, nil
+}
+
+// viewSourceErrors renders the banner listing the sources which can not be read
+func (modal *KubectlCfModal) viewSourceErrors() string {
+	var sources []string
+	for _, sourceError := range modal.sourceErrors {
+		if source := displayPath(sourceError.Source); !slices.Contains(sources, source) { // a catalog may fail more than once
+			sources = append(sources, source)
+		}
+	}
+	banner := t("sourceErrorsBanner", len(sources), strings.Join(sources, ", "))
+	return bannerStyle.MaxWidth(modal.width).Render(warning(banner))
+}
+
+// configArgs describes the arguments of "cf config"
+const configArgs = "view"
+
+// runConfig runs "cf config", which is only dispatched with a subcommand,
+// since "config" is also the name of the default kubeconfig
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "view" {
+		return errors.New(t("commandUsage", "config", configArgs))
+	}
+	return viewConfig()
+}
+
+// sourceView is a source in the output of "cf config view"
+type sourceView struct {
+	Source      `yaml:",inline"`
+	Directories []string `yaml:"directories,omitempty"`
+	Missing     []string `yaml:"missing,omitempty"`
+}
+
+// configView is the output of "cf config view", the effective configuration from the config file and the environment
+type configView struct {
+	ConfigDir      string              `yaml:"configDir"`
+	ConfigFile     string              `yaml:"configFile"`
+	Kubeconfig     string              `yaml:"kubeconfig"`
+	MatchPattern   string              `yaml:"matchPattern"`
+	DecryptPattern string              `yaml:"decryptMatchPattern"`
+	DecryptCommand string              `yaml:"decryptCommand"`
+	Sort           string              `yaml:"sort"`
+	Sources        []sourceView        `yaml:"sources"`
+	Tags           map[string][]string `yaml:"tags,omitempty"`
+}
+
+// viewConfig prints the effective configuration, with each source and the directories expanded from it
+func viewConfig() error {
+	currentKubeconfigPath, err := ReadCurrentKubeconfigPath()
+	if err != nil {
+		return err
+	}
+	view := configView{
+		ConfigDir:      kubectlCfConfigDir,
+		ConfigFile:     configPath,
+		Kubeconfig:     kubeconfigPath,
+		MatchPattern:   kubeconfigFilenameMatchPattern.String(),
+		DecryptPattern: decryptFilenameMatchPattern.String(),
+		DecryptCommand: decryptCommand,
+		Sort:           defaultSortMode,
+		Tags:           config.Tags,
+	}
+	for _, source := range kubeconfigSources {
+		if source.Exec != "" {
+			view.Sources = append(view.Sources, sourceView{Source: source})
+			continue
+		}
+		if isCatalogURL(source.Path) { // kubeconfigs in the catalog are downloaded into the cache dir
+			view.Sources = append(view.Sources, sourceView{Source: source, Directories: []string{catalogCacheDir(source.Path)}})
+			continue
+		}
+		dirs, missing := expandSource(source, currentKubeconfigPath)
+		sv := sourceView{Source: source, Missing: missing}
+		if sv.Detect == "" {
+			sv.Detect = defaultDetectMode
+		}
+		for _, dir := range dirs {
+			sv.Directories = append(sv.Directories, dir.Path)
+		}
+		view.Sources = append(view.Sources, sv)
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(view); err != nil {
+		return errors.Wrap(err, "yaml encode error")
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,226 @@
+package cf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandSourcePath(t *testing.T) {
+	t.Setenv("KUBECTL_CF_TEST_DIR", "/clients")
+	t.Setenv("KUBECTL_CF_TEST_EMPTY", "")
+
+	for _, c := range []struct {
+		entry string
+		want  string
+		ok    bool
+	}{
+		{"$KUBECTL_CF_TEST_DIR/kube", "/clients/kube", true},
+		{"${KUBECTL_CF_TEST_DIR}/*/kube" + RecursiveSourceSuffix, "/clients/*/kube", true},
+		{"$KUBECTL_CF_TEST_EMPTY/kube", "/kube", true}, // set, even if empty
+		{"$KUBECTL_CF_TEST_UNSET/kube", "", false},
+		{"~/kube", filepath.Join(homeDir, "kube"), true},
+		{KubeconfigSpecialPathKubeconfigDir, filepath.Dir("/home/u/.kube/prod.yaml"), true},
+	} {
+		got, ok := expandSourcePath(c.entry, "/home/u/.kube/prod.yaml")
+		if got != c.want || ok != c.ok {
+			t.Errorf("expandSourcePath(%q) = %q, %v, want %q, %v", c.entry, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestExpandSourceSkipsUnsetVariables(t *testing.T) {
+	dirs, missing := expandSource(Source{Path: "$KUBECTL_CF_TEST_UNSET/kube"}, kubeconfigPath)
+	if dirs != nil || missing != nil {
+		t.Errorf("got %v, %v, want the source skipped", dirs, missing)
+	}
+}
+
+func TestListKubeconfigCandidatesInSource(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "prod.yaml", "")
+	writeTestFile(t, root, "team/dev.yaml", "")
+	writeTestFile(t, root, "team/deep/too/deep.yaml", "")
+	writeTestFile(t, root, "skipped/staging.yaml", "")
+	for _, dir := range []string{"empty", "team/new"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(root, filepath.Join(root, "team", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	source := Source{Path: root, Detect: DetectPattern, MaxDepth: 2, Exclude: []string{"skipped/"}, Prefix: "x/"}
+	candidates, dirs, err := ListKubeconfigCandidatesInSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Name)
+	}
+	slices.Sort(names)
+	if want := []string{"x/prod.yaml", "x/team/dev.yaml"}; !slices.Equal(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+
+	slices.Sort(dirs)
+	var want []string
+	for _, dir := range []string{"", "empty", "team", "team/deep", "team/new"} {
+		want = append(want, filepath.Join(root, dir))
+	}
+	if !slices.Equal(dirs, want) {
+		t.Errorf("got scanned dirs %v, want %v", dirs, want)
+	}
+}
+
+func TestSourceExcluded(t *testing.T) {
+	source := Source{Path: "/kube", Exclude: []string{"*.bak", "archive/", "team/*.yaml"}}
+	for _, c := range []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"prod.bak", false, true},
+		{"team/prod.bak", false, true}, // matched by the base name
+		{"archive", true, true},
+		{"team/archive", true, true},
+		{"archive", false, false}, // only directories
+		{"team/prod.yaml", false, true},
+		{"other/team/prod.yaml", false, false}, // relative to the source
+		{"prod.yaml", false, false},
+		{"cache", true, true}, // defaultExcludes
+		{"http-cache", true, true},
+		{"cache", false, false},
+	} {
+		if got := source.excluded(c.rel, c.isDir); got != c.want {
+			t.Errorf("excluded(%q, dir %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestListKubeconfigCandidatesInSourceSkipsExcludedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "prod.conf", "apiVersion: v1\nkind: Config\n")
+	writeTestFile(t, root, "prod.bak", "apiVersion: v1\nkind: Config\n")
+	writeTestFile(t, root, "team/dev.conf", "apiVersion: v1\nkind: Config\n")
+
+	source := Source{Path: root, Detect: DetectContent, MaxDepth: 1, Exclude: []string{"*.bak", "team/*.conf"}}
+	candidates, _, err := ListKubeconfigCandidatesInSource(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Name)
+	}
+	if want := []string{"prod.conf"}; !slices.Equal(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+
+	for _, dir := range []string{root, filepath.Join(root, "team")} {
+		indexed, ok := index[dir]
+		if !ok {
+			t.Fatalf("%s is not indexed", dir)
+		}
+		for _, file := range indexed.Files {
+			if file.FileName != "prod.conf" {
+				t.Errorf("excluded file %s is indexed", filepath.Join(dir, file.FileName))
+			}
+		}
+	}
+}
+
+func TestSourceCompile(t *testing.T) {
+	for _, c := range []struct {
+		source Source
+		ok     bool
+	}{
+		{Source{Path: "/kube"}, true},
+		{Source{Path: "/kube", Pattern: `^(?P<name>.+)\.conf$`, NameTemplate: "{{.CurrentContext}}"}, true},
+		{Source{Path: "/kube", Pattern: `^(?P<name>.+\.conf$`}, false},
+		{Source{Path: "/kube", NameTemplate: "{{.CurrentContext"}, false},
+	} {
+		if err := c.source.compile(); (err == nil) != c.ok {
+			t.Errorf("compile pattern %q, template %q: got %v, want ok %v", c.source.Pattern, c.source.NameTemplate, err, c.ok)
+		}
+	}
+}
+
+func TestSourceRenderName(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := writeTestFile(t, dir, "prod.yaml", "kind: Config\ncurrent-context: prod-admin\n")
+	invalid := writeTestFile(t, dir, "invalid.yaml", "kind: [Config\n")
+
+	for _, c := range []struct {
+		template string
+		path     string
+		want     string
+	}{
+		{"", kubeconfig, "prod"},
+		{"{{.CurrentContext}}", kubeconfig, "prod-admin"},
+		{"{{.Name}}/{{.FileName}}", kubeconfig, "prod/prod.yaml"},
+		{" {{.CurrentContext}}\n", kubeconfig, "prod-admin"}, // trimmed
+		{"{{.CurrentContext}}", invalid, "prod"},             // the kubeconfig can not be parsed
+		{"{{.Missing}}", kubeconfig, "prod"},                 // fails to execute
+		{"{{if false}}x{{end}}", kubeconfig, "prod"},         // renders empty
+	} {
+		source := Source{Path: dir, NameTemplate: c.template}
+		if err := source.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if got := source.renderName(Candidate{Name: "prod", FullPath: c.path}); got != c.want {
+			t.Errorf("render %q with %s: got %q, want %q", c.template, filepath.Base(c.path), got, c.want)
+		}
+	}
+}
+
+func TestListKubeconfigCandidatesInSourceByPattern(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "prod.kubeconfig", "kind: Config\ncurrent-context: prod-admin\n")
+	writeTestFile(t, root, "dev.kubeconfig", "kind: Config\n")
+	writeTestFile(t, root, "staging.yaml", "kind: Config\n")
+
+	for _, c := range []struct {
+		source Source
+		want   []string
+	}{
+		{Source{Path: root, Detect: DetectPattern, Pattern: `^(?P<cluster>.+)\.kubeconfig$`, NameGroup: "cluster"}, []string{"dev", "prod"}},
+		{Source{Path: root, Detect: DetectPattern, Pattern: `^(?P<name>.+)\.kubeconfig$`, NameTemplate: "{{.CurrentContext}}"}, []string{"dev", "prod-admin"}}, // dev has no current context
+		{Source{Path: root, Detect: DetectPattern}, []string{"staging.yaml"}},
+	} {
+		if err := c.source.compile(); err != nil {
+			t.Fatal(err)
+		}
+		candidates, _, err := ListKubeconfigCandidatesInSource(c.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := candidateNames(candidates); !slices.Equal(got, c.want) {
+			t.Errorf("pattern %q, template %q: got names %v, want %v", c.source.Pattern, c.source.NameTemplate, got, c.want)
+		}
+	}
+}
+
+func TestExpandRecursiveSource(t *testing.T) {
+	root := t.TempDir()
+	for _, c := range []struct {
+		source Source
+		want   int
+	}{
+		{Source{Path: root}, 0},
+		{Source{Path: root + RecursiveSourceSuffix}, RecursiveMaxDepthDefault},
+		{Source{Path: root + RecursiveSourceSuffix, MaxDepth: 2}, 2},
+	} {
+		dirs, missing := expandSource(c.source, kubeconfigPath)
+		if len(dirs) != 1 || len(missing) != 0 {
+			t.Fatalf("expand %s: got %v, missing %v", c.source.Path, dirs, missing)
+		}
+		if dirs[0].Path != root || dirs[0].MaxDepth != c.want {
+			t.Errorf("expand %s with max depth %d: got %s with max depth %d, want %s with %d",
+				c.source.Path, c.source.MaxDepth, dirs[0].Path, dirs[0].MaxDepth, root, c.want)
+		}
+	}
+}
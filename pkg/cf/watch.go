@@ -0,0 +1,84 @@
+package cf
+
+import (
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/junchaw/kubectl-cf/pkg/sys"
+)
+
+// WatchDebounce is how long to wait for more changes before the sources are scanned again,
+// editors and sync tools usually write files in bursts
+const WatchDebounce = 300 * time.Millisecond
+
+// filesChangedMsg is sent when files in the watched directories are changed, see watchSources
+type filesChangedMsg struct {
+	watcher *sys.Watcher
+}
+
+// watchSources watches the directories of the scanned sources, and scans them again when files are changed,
+// the watcher is replaced only if the directories are changed, like a new subdirectory in a recursive source.
+// Watching is not supported on platforms other than Linux, "ctrl+r" reloads the list instead.
+func (modal *KubectlCfModal) watchSources() tea.Cmd {
+	var dirs []string
+	for _, scan := range modal.scans {
+		if scan != nil {
+			dirs = append(dirs, scan.dirs...)
+		}
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+	if slices.Equal(dirs, modal.watchedDirs) {
+		return nil
+	}
+	modal.watchedDirs = dirs
+
+	if modal.watcher != nil {
+		_ = modal.watcher.Close()
+		modal.watcher = nil
+	}
+	watcher, err := sys.NewWatcher()
+	if err != nil {
+		logger.Debugf("Unable to watch sources: %s", err)
+		return nil
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil { // like too many watches, the directory is still reloaded by "ctrl+r"
+			logger.Debugf("Unable to watch %s: %s", dir, err)
+		}
+	}
+	modal.watcher = watcher
+	return waitForChanges(watcher)
+}
+
+// waitForChanges returns filesChangedMsg once files are changed and no more changes come in WatchDebounce,
+// nothing is returned after the watcher is closed
+func waitForChanges(watcher *sys.Watcher) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-watcher.Events; !ok {
+			return nil
+		}
+		debounce := time.NewTimer(WatchDebounce)
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return nil
+				}
+				debounce.Reset(WatchDebounce)
+			case <-debounce.C:
+				return filesChangedMsg{watcher: watcher}
+			}
+		}
+	}
+}
+
+// handleFilesChanged scans the sources again in the background, keeping the selected candidate highlighted
+func (modal *KubectlCfModal) handleFilesChanged(msg filesChangedMsg) tea.Cmd {
+	if msg.watcher != modal.watcher { // replaced
+		return nil
+	}
+	logger.Debugf("Files in sources are changed, scanning again")
+	return tea.Batch(modal.startScan(""), waitForChanges(msg.watcher))
+}
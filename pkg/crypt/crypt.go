@@ -0,0 +1,394 @@
+// Package crypt encrypts kubeconfig files at rest, in a format inspired by age (https://age-encryption.org):
+// the content is encrypted with a random file key, and the file key is wrapped for each recipient,
+// a recipient is either a passphrase or an X25519 public key.
+//
+// The encrypted file looks like:
+//
+//	kubectl-cf-encrypted/v1
+//	-> x25519 <ephemeral public key>
+//	<wrapped file key>
+//	-> pbkdf2 <salt> <iterations>
+//	<wrapped file key>
+//	---
+//	<nonce><ciphertext>
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Header is the first line of encrypted files
+	Header = "kubectl-cf-encrypted/v1"
+
+	// headerEnd separates the header and the payload
+	headerEnd = "---"
+
+	// SecretKeyPrefix is the prefix of X25519 identities in key files
+	SecretKeyPrefix = "KUBECTL-CF-SECRET-KEY-"
+
+	// PublicKeyPrefix is the prefix of X25519 recipients
+	PublicKeyPrefix = "kubectl-cf-public-key-"
+
+	// pbkdf2Iterations is the default iterations for passphrase recipients, as recommended by OWASP in 2023
+	pbkdf2Iterations = 600000
+
+	// maxPBKDF2Iterations is the upper limit of iterations accepted when decrypting,
+	// iterations are read from the file, so whoever writes the file could make decryption take forever
+	maxPBKDF2Iterations = 10 * pbkdf2Iterations
+
+	fileKeySize = 32
+)
+
+var (
+	// ErrNoIdentityMatched is returned by Decrypt if none of the identities can unwrap the file key
+	ErrNoIdentityMatched = errors.New("no identity matched")
+
+	b64 = base64.RawStdEncoding
+)
+
+// stanza is a wrapped file key for a recipient
+type stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// Recipient wraps file keys
+type Recipient interface {
+	wrap(fileKey []byte) (*stanza, error)
+}
+
+// Identity unwraps file keys, returns ErrNoIdentityMatched if the stanza is not for it
+type Identity interface {
+	unwrap(s *stanza) ([]byte, error)
+}
+
+// seal encrypts plaintext with key, nonce could be nil for single-use keys
+func seal(key, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher error")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM error")
+	}
+	if nonce == nil {
+		nonce = make([]byte, aead.NonceSize())
+	}
+	return aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts ciphertext sealed by seal
+func open(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher error")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM error")
+	}
+	if nonce == nil {
+		nonce = make([]byte, aead.NonceSize())
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Passphrase is both a Recipient and an Identity, the wrapping key is derived by PBKDF2-SHA256
+type Passphrase string
+
+func (p Passphrase) wrap(fileKey []byte) (*stanza, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "rand.Read error")
+	}
+	key, err := pbkdf2.Key(sha256.New, string(p), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "pbkdf2.Key error")
+	}
+	body, err := seal(key, nil, fileKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &stanza{Type: "pbkdf2", Args: []string{b64.EncodeToString(salt), strconv.Itoa(pbkdf2Iterations)}, Body: body}, nil
+}
+
+func (p Passphrase) unwrap(s *stanza) ([]byte, error) {
+	if s.Type != "pbkdf2" {
+		return nil, ErrNoIdentityMatched
+	}
+	if len(s.Args) != 2 {
+		return nil, errors.New("invalid pbkdf2 stanza")
+	}
+	salt, err := b64.DecodeString(s.Args[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pbkdf2 salt")
+	}
+	iterations, err := strconv.Atoi(s.Args[1])
+	if err != nil || iterations <= 0 {
+		return nil, errors.New("invalid pbkdf2 iterations")
+	}
+	if iterations > maxPBKDF2Iterations {
+		return nil, errors.Errorf("too many pbkdf2 iterations %d, expect at most %d", iterations, maxPBKDF2Iterations)
+	}
+	key, err := pbkdf2.Key(sha256.New, string(p), salt, iterations, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "pbkdf2.Key error")
+	}
+	fileKey, err := open(key, nil, s.Body, nil)
+	if err != nil {
+		return nil, ErrNoIdentityMatched // wrong passphrase
+	}
+	return fileKey, nil
+}
+
+// X25519Recipient wraps file keys for the holder of the X25519Identity
+type X25519Recipient struct {
+	publicKey *ecdh.PublicKey
+}
+
+// X25519Identity is an X25519 private key
+type X25519Identity struct {
+	privateKey *ecdh.PrivateKey
+}
+
+// GenerateX25519Identity generates a new identity
+func GenerateX25519Identity() (*X25519Identity, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate X25519 key error")
+	}
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// ParseX25519Identity parses an identity encoded by X25519Identity.String
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), SecretKeyPrefix)
+	if !ok {
+		return nil, errors.New("invalid secret key prefix")
+	}
+	raw, err := b64.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid secret key encoding")
+	}
+	privateKey, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid secret key")
+	}
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// String encodes the identity, it is a secret
+func (i *X25519Identity) String() string {
+	return SecretKeyPrefix + b64.EncodeToString(i.privateKey.Bytes())
+}
+
+// Recipient returns the recipient of the identity
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{publicKey: i.privateKey.PublicKey()}
+}
+
+// String encodes the recipient
+func (r *X25519Recipient) String() string {
+	return PublicKeyPrefix + b64.EncodeToString(r.publicKey.Bytes())
+}
+
+// x25519WrappingKey derives the wrapping key from the shared secret and both public keys
+func x25519WrappingKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key, err := hkdf.Key(sha256.New, shared, salt, "kubectl-cf/v1/x25519", 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "hkdf.Key error")
+	}
+	return key, nil
+}
+
+func (r *X25519Recipient) wrap(fileKey []byte) (*stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate X25519 key error")
+	}
+	shared, err := ephemeral.ECDH(r.publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "X25519 error")
+	}
+	key, err := x25519WrappingKey(shared, ephemeral.PublicKey().Bytes(), r.publicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	body, err := seal(key, nil, fileKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &stanza{Type: "x25519", Args: []string{b64.EncodeToString(ephemeral.PublicKey().Bytes())}, Body: body}, nil
+}
+
+func (i *X25519Identity) unwrap(s *stanza) ([]byte, error) {
+	if s.Type != "x25519" {
+		return nil, ErrNoIdentityMatched
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("invalid x25519 stanza")
+	}
+	raw, err := b64.DecodeString(s.Args[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid x25519 ephemeral key encoding")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid x25519 ephemeral key")
+	}
+	shared, err := i.privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, errors.Wrap(err, "X25519 error")
+	}
+	key, err := x25519WrappingKey(shared, raw, i.privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := open(key, nil, s.Body, nil)
+	if err != nil {
+		return nil, ErrNoIdentityMatched // encrypted for another key
+	}
+	return fileKey, nil
+}
+
+// IsEncrypted returns true if content is encrypted by Encrypt
+func IsEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(Header+"\n"))
+}
+
+// Encrypt encrypts plaintext for all recipients, each of them can decrypt it
+func Encrypt(plaintext []byte, recipients ...Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipient")
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, errors.Wrap(err, "rand.Read error")
+	}
+
+	var header bytes.Buffer
+	header.WriteString(Header + "\n")
+	for _, recipient := range recipients {
+		s, err := recipient.wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&header, "-> %s\n%s\n", strings.Join(append([]string{s.Type}, s.Args...), " "), b64.EncodeToString(s.Body))
+	}
+	header.WriteString(headerEnd + "\n")
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "rand.Read error")
+	}
+	ciphertext, err := seal(fileKey, nonce, plaintext, header.Bytes()) // the header is authenticated
+	if err != nil {
+		return nil, err
+	}
+	return append(append(header.Bytes(), nonce...), ciphertext...), nil
+}
+
+// parse splits encrypted content into the header (for authentication), stanzas and the payload
+func parse(content []byte) (header []byte, stanzas []*stanza, payload []byte, err error) {
+	reader := bufio.NewReader(bytes.NewReader(content))
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", errors.New("unexpected end of header")
+		}
+		header = append(header, line...)
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	if line, err := readLine(); err != nil || line != Header {
+		return nil, nil, nil, errors.New("not a kubectl-cf encrypted file")
+	}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if line == headerEnd {
+			break
+		}
+		fields, ok := strings.CutPrefix(line, "-> ")
+		if !ok {
+			return nil, nil, nil, errors.New("invalid stanza")
+		}
+		bodyLine, err := readLine()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		body, err := b64.DecodeString(bodyLine)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "invalid stanza body")
+		}
+		parts := strings.Fields(fields)
+		if len(parts) == 0 {
+			return nil, nil, nil, errors.New("invalid stanza")
+		}
+		stanzas = append(stanzas, &stanza{Type: parts[0], Args: parts[1:], Body: body})
+	}
+	return header, stanzas, content[len(header):], nil
+}
+
+// NeedsPassphrase returns true if content can only be decrypted with a passphrase,
+// that is, it has no X25519 stanza
+func NeedsPassphrase(content []byte) bool {
+	_, stanzas, _, err := parse(content)
+	if err != nil {
+		return false
+	}
+	for _, s := range stanzas {
+		if s.Type != "pbkdf2" {
+			return false
+		}
+	}
+	return len(stanzas) > 0
+}
+
+// Decrypt decrypts content with the first identity which can unwrap the file key
+func Decrypt(content []byte, identities ...Identity) ([]byte, error) {
+	header, stanzas, payload, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stanzas {
+		for _, identity := range identities {
+			fileKey, err := identity.unwrap(s)
+			if errors.Is(err, ErrNoIdentityMatched) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(payload) < 12 {
+				return nil, errors.New("payload too short")
+			}
+			plaintext, err := open(fileKey, payload[:12], payload[12:], header)
+			if err != nil {
+				return nil, errors.Wrap(err, "decrypt payload error")
+			}
+			return plaintext, nil
+		}
+	}
+	return nil, ErrNoIdentityMatched
+}
@@ -0,0 +1,118 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const plaintext = "apiVersion: v1\nkind: Config\n"
+
+func mustGenerateX25519Identity(t *testing.T) *X25519Identity {
+	t.Helper()
+	identity, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func mustEncrypt(t *testing.T, recipients ...Recipient) []byte {
+	t.Helper()
+	encrypted, err := Encrypt([]byte(plaintext), recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) {
+		t.Fatal("encrypted content is not recognized by IsEncrypted")
+	}
+	if bytes.Contains(encrypted, []byte(plaintext)) {
+		t.Fatal("encrypted content contains the plaintext")
+	}
+	return encrypted
+}
+
+func TestRoundTrip(t *testing.T) {
+	identity := mustGenerateX25519Identity(t)
+	parsed, err := ParseX25519Identity(identity.String() + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := mustEncrypt(t, identity.Recipient(), Passphrase("secret"))
+	if NeedsPassphrase(encrypted) {
+		t.Error("content encrypted for a key does not need a passphrase")
+	}
+
+	for name, identity := range map[string]Identity{"key": parsed, "passphrase": Passphrase("secret")} {
+		decrypted, err := Decrypt(encrypted, identity)
+		if err != nil {
+			t.Errorf("decrypt with %s: %s", name, err)
+			continue
+		}
+		if string(decrypted) != plaintext {
+			t.Errorf("decrypt with %s: got %q, want %q", name, decrypted, plaintext)
+		}
+	}
+}
+
+func TestWrongIdentity(t *testing.T) {
+	encrypted := mustEncrypt(t, mustGenerateX25519Identity(t).Recipient())
+	if _, err := Decrypt(encrypted, mustGenerateX25519Identity(t), Passphrase("secret")); !errors.Is(err, ErrNoIdentityMatched) {
+		t.Errorf("decrypt with another key: got %v, want ErrNoIdentityMatched", err)
+	}
+
+	encrypted = mustEncrypt(t, Passphrase("secret"))
+	if !NeedsPassphrase(encrypted) {
+		t.Error("content encrypted for a passphrase only needs a passphrase")
+	}
+	if _, err := Decrypt(encrypted, Passphrase("wrong")); !errors.Is(err, ErrNoIdentityMatched) {
+		t.Errorf("decrypt with wrong passphrase: got %v, want ErrNoIdentityMatched", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	identity := mustGenerateX25519Identity(t)
+	encrypted := mustEncrypt(t, identity.Recipient())
+	headerLen := bytes.Index(encrypted, []byte("\n"+headerEnd+"\n")) + len(headerEnd) + 2
+
+	extraStanza := bytes.Replace(encrypted, []byte(Header+"\n"), []byte(Header+"\n-> unknown arg\nAAAA\n"), 1)
+	flippedPayload := bytes.Clone(encrypted)
+	flippedPayload[len(flippedPayload)-1] ^= 1
+	flippedHeader := bytes.Clone(encrypted)
+	flippedHeader[bytes.Index(encrypted, []byte("x25519"))] = 'X'
+
+	for name, content := range map[string][]byte{
+		"extra stanza in header":   extraStanza,
+		"flipped type in header":   flippedHeader,
+		"flipped payload":          flippedPayload,
+		"truncated payload":        encrypted[:headerLen+8],
+		"truncated ciphertext":     encrypted[:len(encrypted)-1],
+		"truncated header":         encrypted[:headerLen-2],
+		"missing header":           encrypted[len(Header)+1:],
+		"header only, no payload":  encrypted[:headerLen],
+		"empty":                    nil,
+		"invalid stanza body":      bytes.Replace(encrypted, []byte(Header+"\n"), []byte(Header+"\n-> x25519\n!!!\n"), 1),
+		"stanza without type line": bytes.Replace(encrypted, []byte(Header+"\n"), []byte(Header+"\nAAAA\n"), 1),
+	} {
+		decrypted, err := Decrypt(content, identity)
+		if err == nil {
+			t.Errorf("%s: decrypted to %q, want an error", name, decrypted)
+		}
+	}
+}
+
+func TestTooManyPBKDF2Iterations(t *testing.T) {
+	encrypted := mustEncrypt(t, Passphrase("secret"))
+	iterations := " " + strconv.Itoa(pbkdf2Iterations) + "\n"
+	if !bytes.Contains(encrypted, []byte(iterations)) {
+		t.Fatal("iterations not found in the header")
+	}
+	tampered := bytes.Replace(encrypted, []byte(iterations), []byte(" 1000000000000\n"), 1)
+
+	_, err := Decrypt(tampered, Passphrase("secret"))
+	if err == nil || errors.Is(err, ErrNoIdentityMatched) || !strings.Contains(err.Error(), "iterations") {
+		t.Errorf("got %v, want an error about too many iterations", err)
+	}
+}
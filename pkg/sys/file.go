@@ -2,12 +2,20 @@ package sys
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// MaxBackUpRevisions is the maximal number of backup revisions of a file
+const MaxBackUpRevisions = 999
+
 func IsSymlink(stat os.FileInfo) bool {
 	return stat.Mode()&os.ModeSymlink != 0
 }
@@ -18,7 +26,7 @@ func IsSymlink(stat os.FileInfo) bool {
 func GenerateBackUpName(basePath, suffix string) (string, error) {
 	index := 0
 	var backupPath string
-	for range 999 {
+	for range MaxBackUpRevisions {
 		if index == 0 {
 			backupPath = fmt.Sprintf("%s%s", basePath, suffix)
 		} else {
@@ -42,53 +50,202 @@ func GenerateBackUpName(basePath, suffix string) (string, error) {
 	return "", errors.New("Too many backup revisions of this file")
 }
 
-// BackUpFile backs up a file, back up file will be named like filePath-backup-n
-func BackUpFile(filePath string) error {
+// BackUp is a backup revision of a file created by GenerateBackUpName
+type BackUp struct {
+	Path     string
+	Revision int
+}
+
+// FindBackUps finds the existing backups generated by GenerateBackUpName with the same basePath and suffix,
+// the file without a revision number, which is basePath+suffix itself, has Revision 0
+func FindBackUps(basePath, suffix string) ([]BackUp, error) {
+	entries, err := os.ReadDir(filepath.Dir(basePath))
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadDir error")
+	}
+	base := filepath.Base(basePath)
+	var backUps []BackUp
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		revisionStr := strings.TrimSuffix(strings.TrimPrefix(name, base), suffix)
+		revision := 0
+		if revisionStr != "" {
+			if !strings.HasPrefix(revisionStr, "-") {
+				continue
+			}
+			revision, err = strconv.Atoi(revisionStr[1:])
+			if err != nil || revision <= 0 || revision >= MaxBackUpRevisions {
+				continue
+			}
+		}
+		backUps = append(backUps, BackUp{Path: filepath.Join(filepath.Dir(basePath), name), Revision: revision})
+	}
+	return backUps, nil
+}
+
+// BackUpFile backs up a file, back up file will be named like filePath-backup-n,
+// returns the path of the backup file
+func BackUpFile(filePath string) (string, error) {
 	backupPath, err := GenerateBackUpName(filePath+"-backup", "")
 	if err != nil {
-		return err
+		return "", err
 	}
 	if err := os.Rename(filePath, backupPath); err != nil {
-		return errors.Wrap(err, "os.Rename error")
+		return "", errors.Wrap(err, "os.Rename error")
 	}
-	return nil
+	return backupPath, nil
 }
 
 // CreateSymlink creates newname as a symbolic link to oldname,
 // if newname not exist or is a symlink, it will be replaced directly,
-// in other cases, it will be backed up first
-func CreateSymlink(linkToOldName, linkFromNewName string) error {
+// in other cases, it will be backed up first, and the path of the backup file is returned
+func CreateSymlink(linkToOldName, linkFromNewName string) (backupPath string, err error) {
 	newStat, err := os.Lstat(linkFromNewName)
 	if err != nil {
 		if os.IsNotExist(err) {
 			if err := os.Symlink(linkToOldName, linkFromNewName); err != nil {
-				return errors.Wrap(err, "create new symlink error")
+				return "", errors.Wrap(err, "create new symlink error")
 			}
-			return nil
+			return "", nil
 		}
-		return errors.Wrap(err, "os.Lstat error")
+		return "", errors.Wrap(err, "os.Lstat error")
 	}
 
 	if IsSymlink(newStat) {
 		// is a symlink
 		if err := os.Remove(linkFromNewName); err != nil {
-			return errors.Wrap(err, "remove old symlink error")
+			return "", errors.Wrap(err, "remove old symlink error")
 		}
 	} else {
 		// is not a symlink
-		if err := BackUpFile(linkFromNewName); err != nil {
-			return errors.Wrap(err, "back up error")
+		if backupPath, err = BackUpFile(linkFromNewName); err != nil {
+			return "", errors.Wrap(err, "back up error")
 		}
 	}
 
 	if err := os.Symlink(linkToOldName, linkFromNewName); err != nil {
-		return errors.Wrap(err, "create symlink error")
+		return backupPath, errors.Wrap(err, "create symlink error")
 	}
 	// This is because some tools (like kube-ps1) unable to detect change to the symbolic link,
 	// and display outdated values.
 	now := time.Now()
 	if err := os.Chtimes(linkFromNewName, now, now); err != nil {
-		return errors.Wrap(err, "change symlink time error")
+		return backupPath, errors.Wrap(err, "change symlink time error")
+	}
+	return backupPath, nil
+}
+
+// CopyFile copies src to dst, dst must not exist, the file mode of src is preserved
+func CopyFile(src, dst string) error {
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		return errors.Wrap(err, "os.Stat error")
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "os.Open error")
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, srcStat.Mode().Perm())
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile error")
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return errors.Wrap(err, "io.Copy error")
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return errors.Wrap(err, "close file error")
 	}
 	return nil
 }
+
+// MoveFile moves src to dst, if they are on different devices,
+// src will be copied to dst and then removed
+func MoveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return errors.Wrap(err, "os.Rename error")
+	}
+	if err := CopyFile(src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return errors.Wrap(err, "os.Remove error")
+	}
+	return nil
+}
+
+// ReplaceSymlink atomically replaces newname with a symbolic link to oldname,
+// by creating a temporary symlink next to newname and renaming it over newname,
+// if newname exists and is not a symlink, it will be backed up first, and the path of the backup file is returned
+func ReplaceSymlink(linkToOldName, linkFromNewName string) (backupPath string, err error) {
+	newStat, err := os.Lstat(linkFromNewName)
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "os.Lstat error")
+	}
+	if err == nil && !IsSymlink(newStat) {
+		if backupPath, err = BackUpFile(linkFromNewName); err != nil {
+			return "", errors.Wrap(err, "back up error")
+		}
+	}
+
+	tmpPath, err := GenerateBackUpName(linkFromNewName+".tmp", "")
+	if err != nil {
+		return backupPath, err
+	}
+	if err := os.Symlink(linkToOldName, tmpPath); err != nil {
+		return backupPath, errors.Wrap(err, "create temporary symlink error")
+	}
+	if err := os.Rename(tmpPath, linkFromNewName); err != nil {
+		_ = os.Remove(tmpPath)
+		return backupPath, errors.Wrap(err, "os.Rename error")
+	}
+	return backupPath, nil
+}
+
+// WipeFile overwrites the content of a regular file with zeros before removing it,
+// so the content is not left in the freed blocks, as far as the filesystem allows
+func WipeFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile error")
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "stat file error")
+	}
+	if _, err := io.CopyN(f, zeroReader{}, stat.Size()); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "overwrite file error")
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "sync file error")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close file error")
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, "os.Remove error")
+	}
+	return nil
+}
+
+// zeroReader reads zeros endlessly
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindBackUps(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"default-kubeconfig.yaml",
+		"default-kubeconfig-1.yaml",
+		"default-kubeconfig-12.yaml",
+		"default-kubeconfig-x.yaml",
+		"default-kubeconfig-0.yaml",
+		"default-kubeconfig1.yaml",
+		"default-kubeconfig-2.yml",
+		"other.yaml",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "default-kubeconfig-3.yaml"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	backUps, err := FindBackUps(filepath.Join(dir, "default-kubeconfig"), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(backUps, func(a, b BackUp) int { return a.Revision - b.Revision })
+	want := []BackUp{
+		{Path: filepath.Join(dir, "default-kubeconfig.yaml"), Revision: 0},
+		{Path: filepath.Join(dir, "default-kubeconfig-1.yaml"), Revision: 1},
+		{Path: filepath.Join(dir, "default-kubeconfig-12.yaml"), Revision: 12},
+	}
+	if !slices.Equal(backUps, want) {
+		t.Errorf("got %v, want %v", backUps, want)
+	}
+}
+
+func TestGenerateBackUpName(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config-backup")
+
+	for i, want := range []string{base, base + "-1", base + "-2"} {
+		got, err := GenerateBackUpName(base, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("revision %d: got %s, want %s", i, got, want)
+		}
+		if err := os.WriteFile(got, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
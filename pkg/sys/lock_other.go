@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package sys
+
+import "os"
+
+// LockFile does nothing on platforms without file locks, concurrent writers may still overwrite each other
+func LockFile(_ *os.File) error {
+	return nil
+}
+
+// UnlockFile does nothing on platforms without file locks
+func UnlockFile(_ *os.File) error {
+	return nil
+}
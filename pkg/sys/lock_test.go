@@ -0,0 +1,49 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	open := func() *os.File {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = f.Close() })
+		return f
+	}
+	a, b := open(), open()
+	if err := LockFile(a); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error, 1)
+	go func() { locked <- LockFile(b) }()
+	select {
+	case err := <-locked:
+		t.Fatalf("the lock is acquired twice: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := UnlockFile(a); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock is not acquired after it is released")
+	}
+	if err := UnlockFile(b); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package sys
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// LockFile blocks until an exclusive advisory lock on f is acquired, released by UnlockFile or closing f
+func LockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EINTR {
+			return errors.Wrap(err, "syscall.Flock error")
+		}
+	}
+}
+
+// UnlockFile releases the lock acquired by LockFile
+func UnlockFile(f *os.File) error {
+	return errors.Wrap(syscall.Flock(int(f.Fd()), syscall.LOCK_UN), "syscall.Flock error")
+}
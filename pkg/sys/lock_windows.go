@@ -0,0 +1,20 @@
+package sys
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// LockFile blocks until an exclusive lock on f is acquired, released by UnlockFile or closing f
+func LockFile(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+	return errors.Wrap(err, "windows.LockFileEx error")
+}
+
+// UnlockFile releases the lock acquired by LockFile
+func UnlockFile(f *os.File) error {
+	err := windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+	return errors.Wrap(err, "windows.UnlockFileEx error")
+}
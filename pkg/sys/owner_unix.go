@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sys
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileOwner returns the uid of the owner of the file, ok is false if unknown
+func FileOwner(info os.FileInfo) (uid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), true
+}
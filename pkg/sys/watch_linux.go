@@ -0,0 +1,63 @@
+//go:build linux
+
+package sys
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// watchMask are the inotify events of files added, removed, renamed or written in a directory,
+// or the directory itself removed or renamed
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Watcher watches changes of files in directories, with inotify on Linux
+type Watcher struct {
+	file *os.File
+
+	// Events receives after files are changed, events are coalesced until received,
+	// it is closed when the watcher is closed
+	Events chan struct{}
+}
+
+// NewWatcher starts a watcher without directories, see Watcher.Add
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "inotify_init1 error")
+	}
+	// the fd is non-blocking, so reading is handled by the runtime poller, and closing the file stops reading
+	w := &Watcher{file: os.NewFile(uintptr(fd), "inotify"), Events: make(chan struct{}, 1)}
+	go w.read()
+	return w, nil
+}
+
+func (w *Watcher) read() {
+	defer close(w.Events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := w.file.Read(buf); err != nil {
+			return
+		}
+		select {
+		case w.Events <- struct{}{}:
+		default: // an event is not received yet
+		}
+	}
+}
+
+// Add watches files in dir
+func (w *Watcher) Add(dir string) error {
+	if _, err := syscall.InotifyAddWatch(int(w.file.Fd()), dir, watchMask|syscall.IN_ONLYDIR); err != nil {
+		return errors.Wrapf(err, "inotify_add_watch error for %s", dir)
+	}
+	return nil
+}
+
+// Close stops watching, Events is closed
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package sys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expect an error for a missing directory")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "prod.yaml"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-w.Events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after a file is added")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-w.Events:
+		for ok { // drain coalesced events
+			_, ok = <-w.Events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events are not closed after the watcher is closed")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package sys
+
+import "github.com/pkg/errors"
+
+// ErrWatchUnsupported is returned by NewWatcher on platforms other than Linux
+var ErrWatchUnsupported = errors.New("watching files is not supported on this platform")
+
+// Watcher watches changes of files in directories, which is only supported on Linux
+type Watcher struct {
+	Events chan struct{}
+}
+
+// NewWatcher always returns ErrWatchUnsupported
+func NewWatcher() (*Watcher, error) {
+	return nil, ErrWatchUnsupported
+}
+
+// Add always returns ErrWatchUnsupported
+func (w *Watcher) Add(_ string) error {
+	return ErrWatchUnsupported
+}
+
+// Close does nothing
+func (w *Watcher) Close() error {
+	return nil
+}